@@ -0,0 +1,58 @@
+package firehose
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ResolveStartAnchor resolves a symbolic start position against the current state of
+// the hub. Accepted anchors are `head` (current head block), `lib` (current last
+// irreversible block), `head-<N>` and `lib-<N>` (N blocks below the head or the last
+// irreversible block). An offset bigger than the reference block resolves to block 0.
+func (sf *StreamFactory) ResolveStartAnchor(anchor string) (uint64, error) {
+	base, offset, err := parseStartAnchor(anchor)
+	if err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid start anchor %q: %s", anchor, err)
+	}
+
+	if sf.hub == nil {
+		return 0, status.Errorf(codes.FailedPrecondition, "cannot resolve start anchor %q: live blocks are not available on this instance", anchor)
+	}
+
+	headNum, _, _, libNum, err := sf.hub.HeadInfo()
+	if err != nil {
+		return 0, status.Errorf(codes.Unavailable, "cannot resolve start anchor %q: %s", anchor, err)
+	}
+
+	ref := headNum
+	if base == "lib" {
+		ref = libNum
+	}
+
+	if offset >= ref {
+		return 0, nil
+	}
+	return ref - offset, nil
+}
+
+func parseStartAnchor(in string) (base string, offset uint64, err error) {
+	in = strings.ToLower(strings.TrimSpace(in))
+
+	base, rawOffset, hasOffset := strings.Cut(in, "-")
+	if base != "head" && base != "lib" {
+		return "", 0, fmt.Errorf("expecting one of head, lib, head-<N> or lib-<N>")
+	}
+	if !hasOffset {
+		return base, 0, nil
+	}
+
+	offset, err = strconv.ParseUint(rawOffset, 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid offset: %w", err)
+	}
+	return base, offset, nil
+}
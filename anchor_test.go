@@ -0,0 +1,129 @@
+package firehose
+
+import (
+	"io"
+	"testing"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/bstream/hub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newTestReadyHub returns a hub whose head block is 10 and last irreversible block is 4
+func newTestReadyHub(t *testing.T) *hub.ForkableHub {
+	t.Helper()
+
+	liveSourceFactory := bstream.NewTestSourceFactory()
+	oneBlocksSourceFactory := bstream.NewTestSourceFactory()
+	forkableHub := hub.NewForkableHub(liveSourceFactory.NewSource, bstream.SourceFromNumFactory(oneBlocksSourceFactory.SourceFromBlockNum), 0)
+	go forkableHub.Run()
+
+	oneBlocks := []*bstream.Block{
+		bstream.TestBlockWithLIBNum("00000003", "00000002", 2),
+		bstream.TestBlockWithLIBNum("00000004", "00000003", 2),
+		bstream.TestBlockWithLIBNum("00000005", "00000004", 2),
+		bstream.TestBlockWithLIBNum("00000008", "00000005", 3),
+	}
+	liveBlocks := []*bstream.Block{
+		bstream.TestBlockWithLIBNum("00000009", "00000008", 3),
+		bstream.TestBlockWithLIBNum("0000000a", "00000009", 4),
+	}
+
+	liveSource := <-liveSourceFactory.Created
+	go func() {
+		oneBlocksSource := <-oneBlocksSourceFactory.Created
+		for _, blk := range oneBlocks {
+			oneBlocksSource.Push(blk, nil)
+		}
+		oneBlocksSource.Shutdown(io.EOF)
+	}()
+	for _, blk := range liveBlocks {
+		require.NoError(t, liveSource.Push(blk, nil))
+	}
+	<-forkableHub.Ready
+
+	t.Cleanup(func() {
+		liveSource.Shutdown(nil)
+		forkableHub.Shutdown(nil)
+	})
+	return forkableHub
+}
+
+func TestParseStartAnchor(t *testing.T) {
+	tests := []struct {
+		in             string
+		expectedBase   string
+		expectedOffset uint64
+		expectedError  bool
+	}{
+		{"head", "head", 0, false},
+		{"lib", "lib", 0, false},
+		{"head-10", "head", 10, false},
+		{"lib-0", "lib", 0, false},
+		{" HEAD-3 ", "head", 3, false},
+		{"", "", 0, true},
+		{"tail", "", 0, true},
+		{"head+1", "", 0, true},
+		{"head-", "", 0, true},
+		{"head-abc", "", 0, true},
+		{"head--1", "", 0, true},
+		{"lib-1-2", "", 0, true},
+		{"10", "", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			base, offset, err := parseStartAnchor(test.in)
+			if test.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedBase, base)
+			assert.Equal(t, test.expectedOffset, offset)
+		})
+	}
+}
+
+func TestResolveStartAnchor(t *testing.T) {
+	sf := NewStreamFactory(nil, nil, newTestReadyHub(t), nil)
+
+	tests := []struct {
+		anchor       string
+		expected     uint64
+		expectedCode codes.Code
+	}{
+		{"head", 10, codes.OK},
+		{"lib", 4, codes.OK},
+		{"head-3", 7, codes.OK},
+		{"lib-1", 3, codes.OK},
+		{"head-10", 0, codes.OK},
+		{"lib-100", 0, codes.OK},
+		{"tail", 0, codes.InvalidArgument},
+	}
+
+	for _, test := range tests {
+		t.Run(test.anchor, func(t *testing.T) {
+			startBlockNum, err := sf.ResolveStartAnchor(test.anchor)
+			if test.expectedCode != codes.OK {
+				assert.Equal(t, test.expectedCode, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, startBlockNum)
+		})
+	}
+}
+
+func TestResolveStartAnchorWithoutReadyHub(t *testing.T) {
+	notReadyHub := hub.NewForkableHub(bstream.NewTestSourceFactory().NewSource, bstream.SourceFromNumFactory(bstream.NewTestSourceFactory().SourceFromBlockNum), 0)
+
+	_, err := NewStreamFactory(nil, nil, notReadyHub, nil).ResolveStartAnchor("head")
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	_, err = NewStreamFactory(nil, nil, nil, nil).ResolveStartAnchor("head")
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
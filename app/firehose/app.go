@@ -16,7 +16,9 @@ package firehose
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"time"
 
@@ -30,6 +32,7 @@ import (
 	"github.com/streamingfast/dstore"
 	"github.com/streamingfast/firehose"
 	"github.com/streamingfast/firehose/metrics"
+	"github.com/streamingfast/firehose/quota"
 	"github.com/streamingfast/firehose/server"
 	"github.com/streamingfast/shutter"
 	"go.uber.org/atomic"
@@ -42,9 +45,23 @@ type Config struct {
 	ForkedBlocksStoreURL    string
 	BlockStreamAddr         string        // gRPC endpoint to get real-time blocks, can be "" in which live streams is disabled
 	GRPCListenAddr          string        // gRPC address where this app will listen to
-	GRPCShutdownGracePeriod time.Duration // The duration we allow for gRPC connections to terminate gracefully prior forcing shutdown
+	GRPCShutdownGracePeriod time.Duration // The duration we allow for gRPC connections to drain and terminate gracefully prior forcing shutdown
 	ServiceDiscoveryURL     *url.URL
 	ServerOptions           []server.Option
+
+	ParallelBackfillWorkers            int   // Number of merged blocks files read concurrently by bounded final-blocks-only requests, 0 disables parallel backfill
+	ParallelBackfillMemoryBudget       int64 // Maximum number of bytes of decoded blocks held in memory across all parallel backfills
+	ParallelBackfillStreamMemoryBudget int64 // Maximum number of bytes of decoded blocks held in memory by a single parallel backfill, 0 means a quarter of ParallelBackfillMemoryBudget
+
+	CursorSigningKeys     []firehose.CursorSigningKey // When set, cursors sent to clients are signed with the first key and verified with any of them
+	AcceptUnsignedCursors bool                        // Accept cursors without signature when CursorSigningKeys is set, useful while clients migrate
+
+	Quotas          *quota.Config // When set, monthly usage quotas of the plans are enforced per user
+	AdminListenAddr string        // HTTP address of the administration API, it is not authenticated and must not be exposed publicly, "" disables it
+
+	AuditLogPath     string // When set, one JSON line is written per `Blocks` and `Block` request to this file
+	AuditLogMaxBytes int64  // Size at which the audit log is rotated, 0 disables rotation
+	AuditLogMaxFiles int    // Number of rotated audit log files kept
 }
 
 type RegisterServiceExtensionFunc func(server dgrpcserver.Server,
@@ -143,15 +160,48 @@ func (a *App) Run() error {
 		go forkableHub.Run()
 	}
 
+	streamFactoryOptions := []firehose.StreamFactoryOption{
+		firehose.WithParallelBackfill(a.config.ParallelBackfillWorkers, a.config.ParallelBackfillMemoryBudget),
+		firehose.WithParallelBackfillStreamBudget(a.config.ParallelBackfillStreamMemoryBudget),
+	}
+	if len(a.config.CursorSigningKeys) > 0 {
+		cursorSigner, err := firehose.NewCursorSigner(a.config.CursorSigningKeys, a.config.AcceptUnsignedCursors)
+		if err != nil {
+			return fmt.Errorf("invalid cursor signing keys: %w", err)
+		}
+		streamFactoryOptions = append(streamFactoryOptions, firehose.WithCursorSigner(cursorSigner))
+	}
+
 	streamFactory := firehose.NewStreamFactory(
 		mergedBlocksStore,
 		forkedBlocksStore,
 		forkableHub,
 		a.modules.TransformRegistry,
+		streamFactoryOptions...,
 	)
 
 	blockGetter := firehose.NewBlockGetter(mergedBlocksStore, forkedBlocksStore, forkableHub)
 
+	serverOptions := append([]server.Option{}, a.config.ServerOptions...)
+
+	var quotaEnforcer *quota.Enforcer
+	if a.config.Quotas != nil {
+		quotaEnforcer, err = quota.New(*a.config.Quotas, a.logger)
+		if err != nil {
+			return fmt.Errorf("failed setting up quotas: %w", err)
+		}
+		serverOptions = append(serverOptions, server.WithQuotas(quotaEnforcer))
+	}
+
+	var auditWriter *server.AuditFileWriter
+	if a.config.AuditLogPath != "" {
+		auditWriter, err = server.NewAuditFileWriter(a.config.AuditLogPath, a.config.AuditLogMaxBytes, a.config.AuditLogMaxFiles)
+		if err != nil {
+			return fmt.Errorf("failed setting up audit log: %w", err)
+		}
+		serverOptions = append(serverOptions, server.WithAuditWriter(auditWriter))
+	}
+
 	firehoseServer := server.New(
 		a.modules.TransformRegistry,
 		streamFactory,
@@ -161,14 +211,43 @@ func (a *App) Run() error {
 		a.IsReady,
 		a.config.GRPCListenAddr,
 		a.config.ServiceDiscoveryURL,
-		a.config.ServerOptions...,
+		serverOptions...,
 	)
 
 	a.OnTerminating(func(_ error) {
-		firehoseServer.Shutdown(a.config.GRPCShutdownGracePeriod)
+		// in-flight streams are asked to terminate with their last cursor first, the
+		// shutdown then only cuts the ones that did not make it within the grace period
+		start := time.Now()
+		firehoseServer.Drain(a.config.GRPCShutdownGracePeriod)
+
+		remaining := a.config.GRPCShutdownGracePeriod - time.Since(start)
+		if remaining < 0 {
+			remaining = 0
+		}
+		firehoseServer.Shutdown(remaining)
+
+		if quotaEnforcer != nil {
+			if err := quotaEnforcer.Close(); err != nil {
+				a.logger.Warn("unable to persist quota usage on shutdown", zap.Error(err))
+			}
+		}
+		if auditWriter != nil {
+			if err := auditWriter.Close(); err != nil {
+				a.logger.Warn("unable to close audit log", zap.Error(err))
+			}
+		}
 	})
 	firehoseServer.OnTerminated(a.Shutdown)
 
+	if a.config.AdminListenAddr != "" {
+		adminMux := http.NewServeMux()
+		adminMux.Handle(server.StreamsAdminPathPrefix, firehoseServer.StreamsAdminHandler())
+		if quotaEnforcer != nil {
+			adminMux.Handle(quota.AdminPathPrefix, quota.NewAdminHandler(quotaEnforcer, a.logger))
+		}
+		a.launchAdminServer(adminMux)
+	}
+
 	if a.modules.RegisterServiceExtension != nil {
 		a.modules.RegisterServiceExtension(
 			firehoseServer.Server,
@@ -197,6 +276,20 @@ func (a *App) Run() error {
 	return nil
 }
 
+func (a *App) launchAdminServer(handler http.Handler) {
+	adminServer := &http.Server{Addr: a.config.AdminListenAddr, Handler: handler}
+	a.OnTerminating(func(_ error) {
+		adminServer.Close()
+	})
+
+	go func() {
+		a.logger.Info("launching admin HTTP server", zap.String("listen_addr", a.config.AdminListenAddr))
+		if err := adminServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			a.Shutdown(fmt.Errorf("admin server: %w", err))
+		}
+	}()
+}
+
 // IsReady return `true` if the apps is ready to accept requests, `false` is returned
 // otherwise.
 func (a *App) IsReady(ctx context.Context) bool {
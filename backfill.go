@@ -0,0 +1,427 @@
+package firehose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/bstream/stream"
+	"github.com/streamingfast/dstore"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+// mergedBlocksBundleSize is the number of blocks contained in each merged blocks file,
+// the bundle size of the bstream file sources reading them.
+const mergedBlocksBundleSize = uint64(100)
+
+// defaultBackfillSegmentSizeEstimate is used to account the decoded blocks of a merged
+// blocks file against the memory budget when its size cannot be retrieved from the store.
+const defaultBackfillSegmentSizeEstimate = 50 * 1024 * 1024
+
+// defaultBackfillDecodedSizeRatio estimates the decoded size of a merged blocks file
+// from its stored size until a first file has been decoded by the backfill.
+const defaultBackfillDecodedSizeRatio = 4.0
+
+// defaultBackfillStreamBudgetShare is the share of the memory budget a single backfill
+// can hold when no per-stream budget is configured: a client that stops reading must
+// not starve the backfills of the other clients.
+const defaultBackfillStreamBudgetShare = 4
+
+// Backfill streams a bounded range of final blocks straight from the merged blocks
+// store. Bundles are read and decoded concurrently by a bounded pool of workers, while
+// the handler still receives the blocks strictly in order, with final cursors.
+//
+// It is created by StreamFactory.NewBackfill for requests accepted by
+// StreamFactory.CanBackfill, or by StreamFactory.NewReverseBackfill in which case
+// blocks are delivered from the stop block down to the start block.
+type Backfill struct {
+	mergedBlocksStore dstore.Store
+	handler           bstream.Handler
+	preprocFunc       bstream.PreprocessFunc
+	preprocThreads    int
+
+	startBlockNum uint64
+	stopBlockNum  uint64
+	descending    bool
+
+	workers          int
+	memoryBudget     *semaphore.Weighted
+	budgetSize       int64
+	streamBudget     *semaphore.Weighted
+	streamBudgetSize int64
+
+	// decodedSizeRatio is the ratio between the decoded size and the stored size of the
+	// last merged blocks file read, used to estimate the next reservations
+	decodedSizeRatio *atomic.Float64
+
+	logger *zap.Logger
+}
+
+type backfillSegment struct {
+	baseNum  uint64
+	fileSize int64
+	reserved int64
+	result   chan *backfillResult
+}
+
+type backfillResult struct {
+	blocks []*bstream.PreprocessedBlock
+	// reserved is what the segment holds from the budgets once its blocks are decoded
+	reserved int64
+	err      error
+}
+
+// cursorObject carries what the handler expects from a bstream source alongside each
+// block, for blocks produced outside of a bstream source
+type cursorObject struct {
+	cursor *bstream.Cursor
+	obj    interface{}
+}
+
+func (o *cursorObject) Cursor() *bstream.Cursor    { return o.cursor }
+func (o *cursorObject) Step() bstream.StepType     { return o.cursor.Step }
+func (o *cursorObject) WrappedObject() interface{} { return o.obj }
+
+// Run reads the whole range and returns stream.ErrStopBlockReached once the stop
+// block has been handled, like a bounded stream.Stream would.
+func (b *Backfill) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+
+	var bases []uint64
+	if b.startBlockNum <= b.stopBlockNum {
+		for base := lowBoundary(b.startBlockNum, mergedBlocksBundleSize); base <= b.stopBlockNum; base += mergedBlocksBundleSize {
+			bases = append(bases, base)
+		}
+	}
+	if b.descending {
+		for i, j := 0, len(bases)-1; i < j; i, j = i+1, j-1 {
+			bases[i], bases[j] = bases[j], bases[i]
+		}
+	}
+
+	b.logger.Info("running parallel backfill",
+		zap.Uint64("start_block", b.startBlockNum),
+		zap.Uint64("stop_block", b.stopBlockNum),
+		zap.Bool("descending", b.descending),
+		zap.Int("workers", b.workers),
+	)
+
+	jobs := make(chan *backfillSegment)
+	ordered := make(chan *backfillSegment, b.workers)
+
+	// dispatcher: reserves memory in segment order so that the next segment to be
+	// delivered can always make progress, then hands segments out to workers.
+	go func() {
+		defer close(jobs)
+		defer close(ordered)
+
+		for _, base := range bases {
+			segment := &backfillSegment{
+				baseNum: base,
+				result:  make(chan *backfillResult, 1),
+			}
+
+			segment.fileSize, segment.reserved = b.estimateSegmentSize(ctx, base)
+			if err := b.acquire(ctx, segment.reserved); err != nil {
+				return
+			}
+
+			select {
+			case ordered <- segment:
+			case <-ctx.Done():
+				b.release(segment.reserved)
+				return
+			}
+
+			select {
+			case jobs <- segment:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var workers sync.WaitGroup
+	for i := 0; i < b.workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for segment := range jobs {
+				segment.result <- b.readSegment(ctx, segment)
+			}
+		}()
+	}
+
+	var pending *backfillSegment
+	defer func() {
+		cancel()
+
+		undelivered := []*backfillSegment{}
+		if pending != nil {
+			undelivered = append(undelivered, pending)
+		}
+		for segment := range ordered {
+			undelivered = append(undelivered, segment)
+		}
+		workers.Wait()
+
+		// give back the memory reserved for segments that will never be delivered
+		for _, segment := range undelivered {
+			select {
+			case res := <-segment.result:
+				b.release(res.reserved)
+			default:
+				b.release(segment.reserved) // never handed to a worker
+			}
+		}
+	}()
+
+	var lastBlockNum uint64
+	var delivered bool
+	for segment := range ordered {
+		var res *backfillResult
+		select {
+		case res = <-segment.result:
+		case <-ctx.Done():
+			pending = segment
+			return ctx.Err()
+		}
+
+		err := res.err
+		if err == nil {
+			for i := range res.blocks {
+				ppBlk := res.blocks[i]
+				if b.descending {
+					ppBlk = res.blocks[len(res.blocks)-1-i]
+				}
+				if delivered && b.outOfOrder(ppBlk.Block.Number, lastBlockNum) {
+					continue
+				}
+				if err = ctx.Err(); err != nil {
+					break
+				}
+
+				ref := ppBlk.Block.AsRef()
+				obj := &cursorObject{
+					cursor: &bstream.Cursor{
+						Step:      bstream.StepIrreversible,
+						Block:     ref,
+						HeadBlock: ref,
+						LIB:       ref,
+					},
+					obj: ppBlk.Obj,
+				}
+				if err = b.handler.ProcessBlock(ppBlk.Block, obj); err != nil {
+					break
+				}
+				lastBlockNum = ppBlk.Block.Number
+				delivered = true
+			}
+		}
+		b.release(res.reserved)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return stream.ErrStopBlockReached
+}
+
+// acquire reserves `size` bytes from the budget of this backfill first, then from the
+// budget shared by all backfills, always in this order so that they cannot deadlock.
+func (b *Backfill) acquire(ctx context.Context, size int64) error {
+	if err := b.streamBudget.Acquire(ctx, size); err != nil {
+		return err
+	}
+	if err := b.memoryBudget.Acquire(ctx, size); err != nil {
+		b.streamBudget.Release(size)
+		return err
+	}
+	return nil
+}
+
+func (b *Backfill) tryAcquire(size int64) bool {
+	if !b.streamBudget.TryAcquire(size) {
+		return false
+	}
+	if !b.memoryBudget.TryAcquire(size) {
+		b.streamBudget.Release(size)
+		return false
+	}
+	return true
+}
+
+func (b *Backfill) release(size int64) {
+	if size == 0 {
+		return
+	}
+	b.memoryBudget.Release(size)
+	b.streamBudget.Release(size)
+}
+
+func (b *Backfill) outOfOrder(blockNum, lastBlockNum uint64) bool {
+	if b.descending {
+		return blockNum >= lastBlockNum
+	}
+	return blockNum <= lastBlockNum
+}
+
+// estimateSegmentSize returns the stored size of the merged blocks file at `baseNum`,
+// 0 when unknown, and the estimated size of its decoded blocks to reserve.
+func (b *Backfill) estimateSegmentSize(ctx context.Context, baseNum uint64) (fileSize int64, size int64) {
+	size = int64(defaultBackfillSegmentSizeEstimate)
+	if attrs, err := b.mergedBlocksStore.ObjectAttributes(ctx, mergedFilename(baseNum)); err == nil && attrs != nil && attrs.Size > 0 {
+		fileSize = attrs.Size
+		size = int64(float64(fileSize) * b.decodedSizeRatio.Load())
+	}
+	return fileSize, b.capSegmentSize(size)
+}
+
+// capSegmentSize caps a reservation to the budgets: a single bundle bigger than the
+// whole budget must still be able to go through.
+func (b *Backfill) capSegmentSize(size int64) int64 {
+	if size > b.budgetSize {
+		size = b.budgetSize
+	}
+	if size > b.streamBudgetSize {
+		size = b.streamBudgetSize
+	}
+	return size
+}
+
+// readSegment reads and decodes the blocks of a segment, then adjusts its reservation
+// to the size of the decoded blocks it holds until they are delivered.
+func (b *Backfill) readSegment(ctx context.Context, segment *backfillSegment) *backfillResult {
+	blocks, decodedSize, err := b.readSegmentBlocks(ctx, segment.baseNum)
+	res := &backfillResult{blocks: blocks, reserved: segment.reserved, err: err}
+	if err != nil {
+		return res
+	}
+
+	if segment.fileSize > 0 && decodedSize > 0 {
+		b.decodedSizeRatio.Store(float64(decodedSize) / float64(segment.fileSize))
+	}
+
+	size := b.capSegmentSize(decodedSize)
+	switch {
+	case size < res.reserved:
+		b.release(res.reserved - size)
+		res.reserved = size
+	case size > res.reserved:
+		// waiting for more memory here could deadlock with the segments that hold it
+		// until this one is delivered, an under-estimated segment goes through as is
+		if b.tryAcquire(size - res.reserved) {
+			res.reserved = size
+		} else {
+			b.logger.Debug("backfill segment over its memory reservation",
+				zap.Uint64("base_num", segment.baseNum),
+				zap.Int64("reserved", res.reserved),
+				zap.Int64("decoded_size", decodedSize),
+			)
+		}
+	}
+	return res
+}
+
+// readSegmentBlocks decodes the blocks of the merged blocks file at `baseNum` as they are
+// read, preprocessing them concurrently with up to StreamMergedBlocksPreprocThreads
+// goroutines like a bstream file source does.
+func (b *Backfill) readSegmentBlocks(ctx context.Context, baseNum uint64) (out []*bstream.PreprocessedBlock, decodedSize int64, err error) {
+	var preprocessing errgroup.Group
+	if b.preprocThreads > 0 {
+		preprocessing.SetLimit(b.preprocThreads)
+	}
+
+	err = readMergedBlocks(ctx, b.mergedBlocksStore, baseNum, func(blk *bstream.Block) error {
+		if blk.Number < b.startBlockNum {
+			return nil
+		}
+		if blk.Number > b.stopBlockNum {
+			return dstore.StopIteration
+		}
+
+		payload, err := blk.Payload.Get()
+		if err != nil {
+			return fmt.Errorf("getting block %s payload: %w", blk, err)
+		}
+		decodedSize += int64(len(payload))
+
+		ppBlk := &bstream.PreprocessedBlock{Block: blk}
+		out = append(out, ppBlk)
+		if b.preprocFunc != nil {
+			preprocessing.Go(func() error {
+				obj, err := b.preprocFunc(blk)
+				if err != nil {
+					return fmt.Errorf("preprocessing block %s: %w", blk, err)
+				}
+				ppBlk.Obj = obj
+				return nil
+			})
+		}
+		return nil
+	})
+	if waitErr := preprocessing.Wait(); err == nil {
+		err = waitErr
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return out, decodedSize, nil
+}
+
+// readMergedBlocks decodes the blocks of the merged blocks file starting at `baseNum`
+// as they are read from the store, calling `f` for each of them until it returns
+// dstore.StopIteration.
+func readMergedBlocks(ctx context.Context, store dstore.Store, baseNum uint64, f func(blk *bstream.Block) error) error {
+	filename := mergedFilename(baseNum)
+	reader, err := store.OpenObject(ctx, filename)
+	if err != nil {
+		if errors.Is(err, dstore.ErrNotFound) {
+			return NewErrRangeNotAvailable(baseNum, baseNum+mergedBlocksBundleSize-1, "merged blocks file not found")
+		}
+		return fmt.Errorf("opening merged blocks file %q: %w", filename, err)
+	}
+	defer reader.Close()
+
+	blockReader, err := bstream.GetBlockReaderFactory.New(reader)
+	if err != nil {
+		return fmt.Errorf("creating block reader for %q: %w", filename, err)
+	}
+
+	for {
+		blk, err := blockReader.Read()
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("reading block from %q: %w", filename, err)
+		}
+		if blk != nil {
+			if err := f(blk); err != nil {
+				if errors.Is(err, dstore.StopIteration) {
+					return nil
+				}
+				return err
+			}
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+func mergedFilename(baseNum uint64) string {
+	return fmt.Sprintf("%010d", baseNum)
+}
+
+func lowBoundary(num uint64, bundleSize uint64) uint64 {
+	return num - (num % bundleSize)
+}
@@ -0,0 +1,354 @@
+package firehose
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/bstream/stream"
+	"github.com/streamingfast/dstore"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newBackfillTestStore holds `bundles` merged blocks files of 100 blocks. Files are
+// slower to open the earlier they are in the chain, so that workers complete them out of
+// order.
+func newBackfillTestStore(t *testing.T, bundles int) *dstore.MockStore {
+	t.Helper()
+
+	store := dstore.NewMockStore(nil)
+	for bundle := 0; bundle < bundles; bundle++ {
+		var blocks []string
+		for num := uint64(bundle * 100); num < uint64(bundle*100+100); num++ {
+			if num == 0 {
+				continue
+			}
+			blocks = append(blocks, bstream.TestJSONBlockWithLIBNum(fmt.Sprintf("%08xa", num), fmt.Sprintf("%08xa", num-1), num-1))
+		}
+		store.SetFile(mergedFilename(uint64(bundle*100)), []byte(strings.Join(blocks, "\n")))
+	}
+
+	store.OpenObjectFunc = func(ctx context.Context, name string) (io.ReadCloser, error) {
+		content, found := store.Files[name]
+		if !found {
+			return nil, dstore.ErrNotFound
+		}
+
+		var baseNum int
+		fmt.Sscanf(name, "%d", &baseNum)
+		select {
+		case <-time.After(time.Duration(bundles-baseNum/100) * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}
+	store.ObjectAttributesFunc = func(_ context.Context, name string) (*dstore.ObjectAttributes, error) {
+		return &dstore.ObjectAttributes{Size: int64(len(store.Files[name]))}, nil
+	}
+
+	return store
+}
+
+// assertBudgetsReleased checks that nothing is left reserved from the budgets of `b`
+func assertBudgetsReleased(t *testing.T, b *Backfill) {
+	t.Helper()
+
+	require.True(t, b.memoryBudget.TryAcquire(b.budgetSize), "memory budget not released")
+	b.memoryBudget.Release(b.budgetSize)
+	require.True(t, b.streamBudget.TryAcquire(b.streamBudgetSize), "stream budget not released")
+	b.streamBudget.Release(b.streamBudgetSize)
+}
+
+func TestBackfillOrdering(t *testing.T) {
+	tests := []struct {
+		name       string
+		request    *pbfirehose.Request
+		descending bool
+		expected   []uint64
+	}{
+		{"ascending", &pbfirehose.Request{StartBlockNum: 50, StopBlockNum: 449, FinalBlocksOnly: true}, false, blockNums(50, 449)},
+		{"descending", &pbfirehose.Request{StartBlockNum: 50, StopBlockNum: 449, FinalBlocksOnly: true}, true, reverse(blockNums(50, 449))},
+		{"ascending single bundle", &pbfirehose.Request{StartBlockNum: 120, StopBlockNum: 150, FinalBlocksOnly: true}, false, blockNums(120, 150)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sf := NewStreamFactory(newBackfillTestStore(t, 5), nil, nil, nil, WithParallelBackfill(4, 100*1024))
+
+			var received []uint64
+			handler := bstream.HandlerFunc(func(blk *bstream.Block, obj interface{}) error {
+				received = append(received, blk.Number)
+
+				cursor := obj.(bstream.Cursorable).Cursor()
+				assert.Equal(t, bstream.StepIrreversible, cursor.Step)
+				assert.Equal(t, blk.AsRef(), cursor.Block)
+				assert.Equal(t, blk.AsRef(), cursor.LIB)
+				assert.True(t, cursor.IsOnFinalBlock())
+				return nil
+			})
+
+			newBackfill := sf.NewBackfill
+			if test.descending {
+				newBackfill = sf.NewReverseBackfill
+			}
+			backfill, err := newBackfill(context.Background(), handler, test.request, false, zap.NewNop())
+			require.NoError(t, err)
+
+			assert.ErrorIs(t, backfill.Run(context.Background()), stream.ErrStopBlockReached)
+			assert.Equal(t, test.expected, received)
+			assertBudgetsReleased(t, backfill)
+		})
+	}
+}
+
+func TestBackfillEarlyTermination(t *testing.T) {
+	handlerErr := errors.New("client gone")
+
+	tests := []struct {
+		name          string
+		handler       func(cancel context.CancelFunc, received int) error
+		expectedError error
+	}{
+		{
+			"context canceled",
+			func(cancel context.CancelFunc, received int) error {
+				if received == 3 {
+					cancel()
+				}
+				return nil
+			},
+			context.Canceled,
+		},
+		{
+			"handler error",
+			func(_ context.CancelFunc, received int) error {
+				if received == 3 {
+					return handlerErr
+				}
+				return nil
+			},
+			handlerErr,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sf := NewStreamFactory(newBackfillTestStore(t, 5), nil, nil, nil, WithParallelBackfill(4, 100*1024))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			received := 0
+			handler := bstream.HandlerFunc(func(blk *bstream.Block, obj interface{}) error {
+				received++
+				return test.handler(cancel, received)
+			})
+
+			backfill, err := sf.NewBackfill(ctx, handler, &pbfirehose.Request{StartBlockNum: 1, StopBlockNum: 499, FinalBlocksOnly: true}, false, zap.NewNop())
+			require.NoError(t, err)
+
+			assert.ErrorIs(t, backfill.Run(ctx), test.expectedError)
+			assert.Less(t, received, 100)
+			assertBudgetsReleased(t, backfill)
+		})
+	}
+}
+
+func TestBackfillStreamBudget(t *testing.T) {
+	store := newBackfillTestStore(t, 5)
+	sf := NewStreamFactory(store, nil, nil, nil, WithParallelBackfill(4, 3*1024))
+	request := &pbfirehose.Request{StartBlockNum: 1, StopBlockNum: 499, FinalBlocksOnly: true}
+
+	// a client that stops reading holds at most its own budget
+	release := make(chan struct{})
+	var slowDone sync.WaitGroup
+	slowDone.Add(1)
+	slow, err := sf.NewBackfill(context.Background(), bstream.HandlerFunc(func(*bstream.Block, interface{}) error {
+		<-release
+		return nil
+	}), request, false, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, int64(3*1024/4), slow.streamBudgetSize)
+	go func() {
+		defer slowDone.Done()
+		slow.Run(context.Background())
+	}()
+	defer func() {
+		close(release)
+		slowDone.Wait()
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	received := 0
+	other, err := sf.NewBackfill(ctx, bstream.HandlerFunc(func(*bstream.Block, interface{}) error {
+		received++
+		return nil
+	}), request, false, zap.NewNop())
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, other.Run(ctx), stream.ErrStopBlockReached)
+	assert.Equal(t, 499, received)
+}
+
+func TestBackfillChargesDecodedSize(t *testing.T) {
+	store := newBackfillTestStore(t, 2)
+	sf := NewStreamFactory(store, nil, nil, nil, WithParallelBackfill(1, 100*1024))
+
+	backfill, err := sf.NewBackfill(context.Background(), bstream.HandlerFunc(func(*bstream.Block, interface{}) error { return nil }),
+		&pbfirehose.Request{StartBlockNum: 120, StopBlockNum: 150, FinalBlocksOnly: true}, false, zap.NewNop())
+	require.NoError(t, err)
+
+	fileSize, reserved := backfill.estimateSegmentSize(context.Background(), 100)
+	assert.Equal(t, int64(len(store.Files[mergedFilename(100)])), fileSize)
+	assert.Equal(t, int64(float64(fileSize)*defaultBackfillDecodedSizeRatio), reserved)
+	require.NoError(t, backfill.acquire(context.Background(), reserved))
+
+	res := backfill.readSegment(context.Background(), &backfillSegment{baseNum: 100, fileSize: fileSize, reserved: reserved})
+	require.NoError(t, res.err)
+	require.Len(t, res.blocks, 31)
+
+	var decodedSize int64
+	for _, ppBlk := range res.blocks {
+		payload, err := ppBlk.Block.Payload.Get()
+		require.NoError(t, err)
+		decodedSize += int64(len(payload))
+	}
+	assert.Equal(t, decodedSize, res.reserved, "only the decoded blocks kept are charged")
+	assert.Equal(t, float64(decodedSize)/float64(fileSize), backfill.decodedSizeRatio.Load())
+
+	backfill.release(res.reserved)
+	assertBudgetsReleased(t, backfill)
+}
+
+func TestBackfillPreprocThreads(t *testing.T) {
+	sf := NewStreamFactory(newBackfillTestStore(t, 2), nil, nil, nil, WithParallelBackfill(1, 100*1024))
+
+	var received []interface{}
+	backfill, err := sf.NewBackfill(context.Background(), bstream.HandlerFunc(func(_ *bstream.Block, obj interface{}) error {
+		received = append(received, obj.(bstream.ObjectWrapper).WrappedObject())
+		return nil
+	}), &pbfirehose.Request{StartBlockNum: 1, StopBlockNum: 199, FinalBlocksOnly: true}, false, zap.NewNop())
+	require.NoError(t, err)
+
+	var running, maxRunning atomic.Int32
+	backfill.preprocThreads = 3
+	backfill.preprocFunc = func(blk *bstream.Block) (interface{}, error) {
+		current := running.Inc()
+		defer running.Dec()
+		for {
+			max := maxRunning.Load()
+			if current <= max || maxRunning.CompareAndSwap(max, current) {
+				break
+			}
+		}
+		time.Sleep(100 * time.Microsecond)
+		return blk.Number, nil
+	}
+
+	assert.ErrorIs(t, backfill.Run(context.Background()), stream.ErrStopBlockReached)
+	require.Len(t, received, 199)
+	for i, obj := range received {
+		assert.Equal(t, uint64(i+1), obj)
+	}
+	assert.LessOrEqual(t, maxRunning.Load(), int32(3))
+	assert.Greater(t, maxRunning.Load(), int32(1))
+}
+
+func TestNewReverseBackfill(t *testing.T) {
+	cursor := func(num uint64) string {
+		ref := bstream.NewBlockRef(fmt.Sprintf("%08xa", num), num)
+		return (&bstream.Cursor{Step: bstream.StepIrreversible, Block: ref, HeadBlock: ref, LIB: ref}).ToOpaque()
+	}
+
+	tests := []struct {
+		name          string
+		request       *pbfirehose.Request
+		expected      []uint64
+		expectedError codes.Code
+	}{
+		{"no cursor", &pbfirehose.Request{StartBlockNum: 50, StopBlockNum: 249, FinalBlocksOnly: true}, reverse(blockNums(50, 249)), codes.OK},
+		{"resumed", &pbfirehose.Request{StartBlockNum: 50, StopBlockNum: 249, FinalBlocksOnly: true, Cursor: EncodeDescendingCursor(cursor(120))}, reverse(blockNums(50, 119)), codes.OK},
+		{"resumed on start block", &pbfirehose.Request{StartBlockNum: 50, StopBlockNum: 249, FinalBlocksOnly: true, Cursor: EncodeDescendingCursor(cursor(50))}, nil, codes.OK},
+		{"resumed on block 0", &pbfirehose.Request{StartBlockNum: 0, StopBlockNum: 249, FinalBlocksOnly: true, Cursor: EncodeDescendingCursor(cursor(0))}, nil, codes.OK},
+		{"ascending cursor", &pbfirehose.Request{StartBlockNum: 50, StopBlockNum: 249, FinalBlocksOnly: true, Cursor: cursor(120)}, nil, codes.InvalidArgument},
+		{"cursor after stop block", &pbfirehose.Request{StartBlockNum: 50, StopBlockNum: 249, FinalBlocksOnly: true, Cursor: EncodeDescendingCursor(cursor(300))}, nil, codes.InvalidArgument},
+		{"not final blocks only", &pbfirehose.Request{StartBlockNum: 50, StopBlockNum: 249}, nil, codes.InvalidArgument},
+		{"unbounded", &pbfirehose.Request{StartBlockNum: 50, FinalBlocksOnly: true}, nil, codes.InvalidArgument},
+		{"start after stop", &pbfirehose.Request{StartBlockNum: 250, StopBlockNum: 249, FinalBlocksOnly: true}, nil, codes.InvalidArgument},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sf := NewStreamFactory(newBackfillTestStore(t, 3), nil, nil, nil)
+
+			var received []uint64
+			backfill, err := sf.NewReverseBackfill(context.Background(), bstream.HandlerFunc(func(blk *bstream.Block, obj interface{}) error {
+				received = append(received, blk.Number)
+				return nil
+			}), test.request, false, zap.NewNop())
+			if test.expectedError != codes.OK {
+				assert.Equal(t, test.expectedError, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+
+			assert.ErrorIs(t, backfill.Run(context.Background()), stream.ErrStopBlockReached)
+			assert.Equal(t, test.expected, received)
+		})
+	}
+}
+
+func TestDescendingCursor(t *testing.T) {
+	ref := bstream.NewBlockRef("00000012a", 12)
+	blockCursor := (&bstream.Cursor{Step: bstream.StepIrreversible, Block: ref, HeadBlock: ref, LIB: ref}).ToOpaque()
+
+	descending := EncodeDescendingCursor(blockCursor)
+	assert.True(t, IsDescendingCursor(descending))
+	assert.True(t, IsDescendingCursor(EncodeSegmentCursor(1, descending)))
+	assert.False(t, IsDescendingCursor(blockCursor))
+	assert.False(t, IsDescendingCursor(EncodeSegmentCursor(1, blockCursor)))
+
+	inner, err := DecodeDescendingCursor(descending)
+	require.NoError(t, err)
+	assert.Equal(t, blockCursor, inner)
+
+	info, err := DecodeCursor(descending)
+	require.NoError(t, err)
+	assert.Equal(t, ref, info.Block)
+	assert.True(t, info.Descending)
+
+	cursor, err := NewStreamFactory(nil, nil, nil, nil).DecodeCursor(EncodeSegmentCursor(1, descending))
+	require.NoError(t, err)
+	assert.Equal(t, ref, cursor.Block)
+}
+
+func blockNums(from, to uint64) (out []uint64) {
+	for num := from; num <= to; num++ {
+		out = append(out, num)
+	}
+	return
+}
+
+func reverse(in []uint64) (out []uint64) {
+	for i := len(in) - 1; i >= 0; i-- {
+		out = append(out, in[i])
+	}
+	return
+}
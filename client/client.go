@@ -19,22 +19,10 @@ import (
 func NewFirehoseClient(endpoint, jwt string, useInsecureTSLConnection, usePlainTextConnection bool) (cli pbfirehose.StreamClient, closeFunc func() error, callOpts []grpc.CallOption, err error) {
 	skipAuth := jwt == "" || usePlainTextConnection
 
-	if useInsecureTSLConnection && usePlainTextConnection {
-		return nil, nil, nil, fmt.Errorf("option --insecure and --plaintext are mutually exclusive, they cannot be both specified at the same time")
-	}
-
-	var dialOptions []grpc.DialOption
-	switch {
-	case usePlainTextConnection:
-		dialOptions = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
-
-	case useInsecureTSLConnection:
-		dialOptions = []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: true}))}
-	}
-
-	conn, err := dgrpc.NewExternalClient(endpoint, dialOptions...)
+	// the JWT is sent with the call options rather than by the connection
+	conn, err := newClientConn(endpoint, "", useInsecureTSLConnection, usePlainTextConnection)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("unable to create external gRPC client: %w", err)
+		return nil, nil, nil, err
 	}
 	closeFunc = conn.Close
 	cli = pbfirehose.NewStreamClient(conn)
@@ -48,9 +36,22 @@ func NewFirehoseClient(endpoint, jwt string, useInsecureTSLConnection, usePlainT
 }
 
 func NewFirehoseFetchClient(endpoint, jwt string, useInsecureTSLConnection, usePlainTextConnection bool) (cli pbfirehose.FetchClient, closeFunc func() error, err error) {
+	conn, err := newClientConn(endpoint, jwt, useInsecureTSLConnection, usePlainTextConnection)
+	if err != nil {
+		return nil, nil, err
+	}
+	closeFunc = conn.Close
+	cli = pbfirehose.NewFetchClient(conn)
+
+	return
+}
 
+// newClientConn dials `endpoint` over TLS, skipping the verification of the server
+// certificate with `useInsecureTSLConnection`, or in plain text with
+// `usePlainTextConnection`. A non-empty `jwt` is sent with every call made over TLS.
+func newClientConn(endpoint, jwt string, useInsecureTSLConnection, usePlainTextConnection bool) (*grpc.ClientConn, error) {
 	if useInsecureTSLConnection && usePlainTextConnection {
-		return nil, nil, fmt.Errorf("option --insecure and --plaintext are mutually exclusive, they cannot be both specified at the same time")
+		return nil, fmt.Errorf("option --insecure and --plaintext are mutually exclusive, they cannot be both specified at the same time")
 	}
 
 	var dialOptions []grpc.DialOption
@@ -69,10 +70,7 @@ func NewFirehoseFetchClient(endpoint, jwt string, useInsecureTSLConnection, useP
 
 	conn, err := dgrpc.NewExternalClient(endpoint, dialOptions...)
 	if err != nil {
-		return nil, nil, fmt.Errorf("unable to create external gRPC client: %w", err)
+		return nil, fmt.Errorf("unable to create external gRPC client: %w", err)
 	}
-	closeFunc = conn.Close
-	cli = pbfirehose.NewFetchClient(conn)
-
-	return
+	return conn, nil
 }
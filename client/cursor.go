@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+
+	"github.com/streamingfast/firehose"
+	pbcursor "github.com/streamingfast/firehose/pb/streamingfast/firehose/cursor/v1"
+	"google.golang.org/grpc"
+)
+
+// DecodeCursor decodes an opaque cursor locally into its step, block, LIB and head
+// block references. Use InspectCursor to know its status against a server.
+func DecodeCursor(cursor string) (*firehose.CursorInfo, error) {
+	return firehose.DecodeCursor(cursor)
+}
+
+// InspectCursor asks the server behind `conn` to decode `cursor` and to check whether
+// its block is still canonical, whether it can be resumed on that server and how far
+// behind the head block it is.
+func InspectCursor(ctx context.Context, conn grpc.ClientConnInterface, cursor string, opts ...grpc.CallOption) (*firehose.CursorInfo, error) {
+	out, err := pbcursor.NewCursorInspectorClient(conn).InspectCursor(ctx, &pbcursor.InspectCursorRequest{Cursor: cursor}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return firehose.CursorInfoFromProto(out), nil
+}
+
+// conn, closeFunc, err := NewCursorInspectorConn(endpoint, jwt, insecure, plaintext)
+// defer closeFunc()
+// info, err := InspectCursor(context.Background(), conn, cursor)
+func NewCursorInspectorConn(endpoint, jwt string, useInsecureTSLConnection, usePlainTextConnection bool) (conn *grpc.ClientConn, closeFunc func() error, err error) {
+	conn, err = newClientConn(endpoint, jwt, useInsecureTSLConnection, usePlainTextConnection)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, conn.Close, nil
+}
@@ -0,0 +1,246 @@
+package firehose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/dstore"
+	pbcursor "github.com/streamingfast/firehose/pb/streamingfast/firehose/cursor/v1"
+)
+
+type Canonicality string
+
+const (
+	CanonicalityUnknown   Canonicality = "unknown"
+	CanonicalityCanonical Canonicality = "canonical"
+	CanonicalityForked    Canonicality = "forked"
+)
+
+// CursorInfo is the decoded content of a cursor along with, when inspected by a server,
+// its status against the chain known by that server.
+type CursorInfo struct {
+	Step      bstream.StepType
+	Block     bstream.BlockRef
+	LIB       bstream.BlockRef
+	HeadBlock bstream.BlockRef
+
+	Canonical Canonicality
+
+	// Resumable is true when the cursor can be used to resume a stream on the server
+	// that inspected it, NotResumableReason explains why otherwise.
+	Resumable          bool
+	NotResumableReason string
+
+	// ServerHeadNum is the head block number of the server that inspected the cursor, 0
+	// when unknown, and BlocksBehindHead the distance between it and the cursor block.
+	ServerHeadNum    uint64
+	BlocksBehindHead uint64
+
+	// MultiRange is true for cursors issued by multi-range requests, Segment being the
+	// index of the range the cursor belongs to. SegmentBoundary is true for the cursors
+	// of segment boundaries, which reference no block and resume at the start of
+	// Segment.
+	MultiRange      bool
+	Segment         int
+	SegmentBoundary bool
+	// Descending is true for cursors issued by descending order requests
+	Descending bool
+}
+
+// DecodeCursor decodes an opaque cursor without checking it against any chain. The
+// signature of signed cursors is ignored.
+func DecodeCursor(in string) (*CursorInfo, error) {
+	if IsSegmentBoundaryCursor(in) {
+		return newSegmentBoundaryInfo(in), nil
+	}
+
+	blockCursor, err := unwrapCursor(in)
+	if err != nil {
+		return nil, NewErrInvalidCursor(in, err)
+	}
+
+	opaqueCursor, _, _, _ := splitCursorSignature(blockCursor)
+	cursor, err := bstream.CursorFromOpaque(opaqueCursor)
+	if err != nil {
+		return nil, NewErrInvalidCursor(in, err)
+	}
+
+	return newCursorInfo(in, cursor), nil
+}
+
+func newCursorInfo(in string, cursor *bstream.Cursor) *CursorInfo {
+	info := &CursorInfo{
+		Step:      cursor.Step,
+		Block:     cursor.Block,
+		LIB:       cursor.LIB,
+		HeadBlock: cursor.HeadBlock,
+		Canonical: CanonicalityUnknown,
+	}
+	if segment, _, err := DecodeSegmentCursor(in); err == nil {
+		info.MultiRange = true
+		info.Segment = segment
+	}
+	info.Descending = IsDescendingCursor(in)
+	return info
+}
+
+func newSegmentBoundaryInfo(in string) *CursorInfo {
+	segment, _, _ := DecodeSegmentCursor(in)
+	return &CursorInfo{
+		Block:           bstream.BlockRefEmpty,
+		LIB:             bstream.BlockRefEmpty,
+		HeadBlock:       bstream.BlockRefEmpty,
+		Canonical:       CanonicalityUnknown,
+		MultiRange:      true,
+		Segment:         segment,
+		SegmentBoundary: true,
+	}
+}
+
+// InspectCursor decodes an opaque cursor, verifying its signature, and checks it
+// against the blocks known by the hub and the merged blocks store.
+func (sf *StreamFactory) InspectCursor(ctx context.Context, opaqueCursor string) (*CursorInfo, error) {
+	if IsSegmentBoundaryCursor(opaqueCursor) {
+		// no block to check, it resumes at the start of its segment given the same ranges
+		info := newSegmentBoundaryInfo(opaqueCursor)
+		info.ServerHeadNum, _ = sf.HeadAndLIBNum()
+		info.Resumable = true
+		return info, nil
+	}
+
+	cursor, err := sf.DecodeCursor(opaqueCursor)
+	if err != nil {
+		return nil, err
+	}
+	info := newCursorInfo(opaqueCursor, cursor)
+
+	headNum, _ := sf.HeadAndLIBNum()
+	info.ServerHeadNum = headNum
+	blockNum := info.Block.Num()
+	if headNum > blockNum {
+		info.BlocksBehindHead = headNum - blockNum
+	}
+
+	if headNum != 0 && blockNum > headNum {
+		info.NotResumableReason = fmt.Sprintf("cursor block is above the head block %d of this server", headNum)
+		return info, nil
+	}
+
+	if sf.hub != nil && sf.hub.IsReady() && blockNum > sf.hub.LowestBlockNum() {
+		if canonical := sf.hub.GetBlock(blockNum, ""); canonical != nil {
+			if canonical.Id == info.Block.ID() {
+				info.Canonical = CanonicalityCanonical
+				info.Resumable = true
+				return info, nil
+			}
+			info.Canonical = CanonicalityForked
+		}
+
+		if sf.hub.GetBlock(blockNum, info.Block.ID()) != nil {
+			// the fork is still known, resuming sends the undo steps
+			info.Resumable = true
+			return info, nil
+		}
+	}
+
+	mergedBlocksStore, err := requestStore(ctx, sf.mergedBlocksStore, BlockSourceMergedBlocks)
+	if err != nil {
+		return nil, err
+	}
+
+	blk, err := fetchMergedBlock(ctx, blockNum, mergedBlocksStore)
+	if errors.Is(err, dstore.ErrNotFound) {
+		if info.Canonical == CanonicalityForked {
+			info.NotResumableReason = "cursor block is on a fork unknown to this server"
+		} else {
+			info.NotResumableReason = "cursor block is not known by this server"
+		}
+		return info, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fetching cursor block %d from merged blocks: %w", blockNum, err)
+	}
+
+	if blk.Id == info.Block.ID() {
+		info.Canonical = CanonicalityCanonical
+		info.Resumable = true
+		return info, nil
+	}
+
+	info.Canonical = CanonicalityForked
+	info.NotResumableReason = "cursor block is on a fork unknown to this server"
+	return info, nil
+}
+
+// ToProto converts the info to the response of the cursor introspection RPC.
+func (i *CursorInfo) ToProto() *pbcursor.InspectCursorResponse {
+	return &pbcursor.InspectCursorResponse{
+		Step:               uint32(i.Step),
+		StepName:           i.Step.String(),
+		Block:              blockRefToProto(i.Block),
+		Lib:                blockRefToProto(i.LIB),
+		HeadBlock:          blockRefToProto(i.HeadBlock),
+		Canonical:          i.Canonical.toProto(),
+		Resumable:          i.Resumable,
+		NotResumableReason: i.NotResumableReason,
+		ServerHeadNum:      i.ServerHeadNum,
+		BlocksBehindHead:   i.BlocksBehindHead,
+		MultiRange:         i.MultiRange,
+		Segment:            uint32(i.Segment),
+		SegmentBoundary:    i.SegmentBoundary,
+		Descending:         i.Descending,
+	}
+}
+
+// CursorInfoFromProto converts the response of the cursor introspection RPC back to a
+// CursorInfo.
+func CursorInfoFromProto(in *pbcursor.InspectCursorResponse) *CursorInfo {
+	return &CursorInfo{
+		Step:               bstream.StepType(in.Step),
+		Block:              blockRefFromProto(in.Block),
+		LIB:                blockRefFromProto(in.Lib),
+		HeadBlock:          blockRefFromProto(in.HeadBlock),
+		Canonical:          canonicalityFromProto(in.Canonical),
+		Resumable:          in.Resumable,
+		NotResumableReason: in.NotResumableReason,
+		ServerHeadNum:      in.ServerHeadNum,
+		BlocksBehindHead:   in.BlocksBehindHead,
+		MultiRange:         in.MultiRange,
+		Segment:            int(in.Segment),
+		SegmentBoundary:    in.SegmentBoundary,
+		Descending:         in.Descending,
+	}
+}
+
+func blockRefToProto(ref bstream.BlockRef) *pbcursor.BlockRef {
+	return &pbcursor.BlockRef{Num: ref.Num(), Id: ref.ID()}
+}
+
+func blockRefFromProto(ref *pbcursor.BlockRef) bstream.BlockRef {
+	if ref == nil {
+		return bstream.BlockRefEmpty
+	}
+	return bstream.NewBlockRef(ref.Id, ref.Num)
+}
+
+func (c Canonicality) toProto() pbcursor.Canonicality {
+	switch c {
+	case CanonicalityCanonical:
+		return pbcursor.Canonicality_CANONICALITY_CANONICAL
+	case CanonicalityForked:
+		return pbcursor.Canonicality_CANONICALITY_FORKED
+	}
+	return pbcursor.Canonicality_CANONICALITY_UNKNOWN
+}
+
+func canonicalityFromProto(c pbcursor.Canonicality) Canonicality {
+	switch c {
+	case pbcursor.Canonicality_CANONICALITY_CANONICAL:
+		return CanonicalityCanonical
+	case pbcursor.Canonicality_CANONICALITY_FORKED:
+		return CanonicalityForked
+	}
+	return CanonicalityUnknown
+}
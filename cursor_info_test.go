@@ -0,0 +1,105 @@
+package firehose
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorInfoProtoRoundTrip(t *testing.T) {
+	info := &CursorInfo{
+		Step:               bstream.StepUndo,
+		Block:              bstream.NewBlockRef("12b", 12),
+		LIB:                bstream.NewBlockRef("10a", 10),
+		HeadBlock:          bstream.NewBlockRef("13a", 13),
+		Canonical:          CanonicalityForked,
+		NotResumableReason: "cursor block is on a fork unknown to this server",
+		ServerHeadNum:      20,
+		BlocksBehindHead:   8,
+		MultiRange:         true,
+		Segment:            2,
+		Descending:         true,
+	}
+
+	assert.Equal(t, info, CursorInfoFromProto(info.ToProto()))
+}
+
+func TestDecodeCursor(t *testing.T) {
+	_, err := DecodeCursor("not a cursor")
+	var errInvalidCursor *ErrInvalidCursor
+	assert.ErrorAs(t, err, &errInvalidCursor)
+}
+
+func TestInspectCursor(t *testing.T) {
+	store := dstore.NewMockStore(nil)
+	store.SetFile("0000000000", []byte(strings.Join([]string{
+		bstream.TestJSONBlockWithLIBNum("00000002a", "00000001a", 1),
+		bstream.TestJSONBlockWithLIBNum("00000003a", "00000002a", 2),
+	}, "\n")))
+	// like the actual stores, unlike dstore.MockStore
+	store.OpenObjectFunc = func(_ context.Context, name string) (io.ReadCloser, error) {
+		content, found := store.Files[name]
+		if !found {
+			return nil, dstore.ErrNotFound
+		}
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}
+
+	sf := NewStreamFactory(store, nil, nil, nil)
+
+	cursor := func(id string, num uint64) string {
+		ref := bstream.NewBlockRef(id, num)
+		return (&bstream.Cursor{Step: bstream.StepNew, Block: ref, HeadBlock: ref, LIB: bstream.NewBlockRef("00000001a", 1)}).ToOpaque()
+	}
+
+	tests := []struct {
+		name              string
+		cursor            string
+		expectedCanonical Canonicality
+		expectedResumable bool
+	}{
+		{"canonical", cursor("00000003a", 3), CanonicalityCanonical, true},
+		{"forked", cursor("00000003b", 3), CanonicalityForked, false},
+		{"not merged", cursor("00000103a", 103), CanonicalityUnknown, false},
+		{"missing from merged file", cursor("00000004a", 4), CanonicalityUnknown, false},
+		{"multi-range", EncodeSegmentCursor(1, cursor("00000003a", 3)), CanonicalityCanonical, true},
+		{"segment boundary", EncodeSegmentCursor(2, ""), CanonicalityUnknown, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := sf.InspectCursor(context.Background(), test.cursor)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedCanonical, info.Canonical)
+			assert.Equal(t, test.expectedResumable, info.Resumable)
+			assert.Equal(t, IsSegmentCursor(test.cursor), info.MultiRange)
+			assert.Equal(t, IsSegmentBoundaryCursor(test.cursor), info.SegmentBoundary)
+			if !test.expectedResumable {
+				assert.NotEmpty(t, info.NotResumableReason)
+			}
+			assertNoFileSource(t)
+		})
+	}
+}
+
+func TestInspectCursorStoreUnavailable(t *testing.T) {
+	store := dstore.NewMockStore(nil)
+	store.OpenObjectFunc = func(context.Context, string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("connection refused")
+	}
+	sf := NewStreamFactory(store, nil, nil, nil)
+
+	ref := bstream.NewBlockRef("00000003a", 3)
+	_, err := sf.InspectCursor(context.Background(), (&bstream.Cursor{Step: bstream.StepNew, Block: ref, HeadBlock: ref, LIB: ref}).ToOpaque())
+
+	var errStoreUnavailable *ErrStoreUnavailable
+	assert.ErrorAs(t, err, &errStoreUnavailable)
+}
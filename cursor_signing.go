@@ -0,0 +1,117 @@
+package firehose
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CursorSigningKey is an HMAC key used to sign the cursors sent to clients.
+type CursorSigningKey struct {
+	// ID identifies the key within signed cursors, it must not contain any `.`.
+	ID     string
+	Secret []byte
+
+	// NotAfter ends the grace window of a key that was rotated out: cursors signed with
+	// it are rejected after that time. The zero value means the key never expires.
+	NotAfter time.Time
+}
+
+// MarshalJSON redacts the secret so keys can be logged along with the configuration
+func (k CursorSigningKey) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"id":        k.ID,
+		"secret":    "<redacted>",
+		"not_after": k.NotAfter,
+	})
+}
+
+// CursorSigner signs opaque cursors with HMAC-SHA256 and verifies them. A signed cursor
+// is the opaque cursor followed by `.<key id>.<signature>`.
+type CursorSigner struct {
+	active         CursorSigningKey
+	keys           map[string]CursorSigningKey
+	acceptUnsigned bool
+}
+
+// NewCursorSigner returns a signer that signs with the first key of `keys` and
+// verifies with any of them. To rotate keys, put the new key first and keep the
+// previous one, with a `NotAfter` covering the time clients need to pick up new
+// cursors. Cursors without any signature are accepted only if `acceptUnsigned` is true.
+func NewCursorSigner(keys []CursorSigningKey, acceptUnsigned bool) (*CursorSigner, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one cursor signing key is required")
+	}
+
+	s := &CursorSigner{
+		active:         keys[0],
+		keys:           make(map[string]CursorSigningKey, len(keys)),
+		acceptUnsigned: acceptUnsigned,
+	}
+
+	for _, key := range keys {
+		if key.ID == "" || strings.Contains(key.ID, ".") {
+			return nil, fmt.Errorf("invalid cursor signing key id %q: must be non-empty and not contain '.'", key.ID)
+		}
+		if len(key.Secret) == 0 {
+			return nil, fmt.Errorf("cursor signing key %q has an empty secret", key.ID)
+		}
+		if _, found := s.keys[key.ID]; found {
+			return nil, fmt.Errorf("duplicate cursor signing key id %q", key.ID)
+		}
+		s.keys[key.ID] = key
+	}
+
+	return s, nil
+}
+
+func (s *CursorSigner) Sign(opaqueCursor string) string {
+	return opaqueCursor + "." + s.active.ID + "." + cursorSignature(s.active, opaqueCursor)
+}
+
+// Verify checks the signature of `signedCursor` and returns the opaque cursor it signs.
+func (s *CursorSigner) Verify(signedCursor string) (string, error) {
+	opaqueCursor, keyID, signature, signed := splitCursorSignature(signedCursor)
+	if !signed {
+		if s.acceptUnsigned {
+			return opaqueCursor, nil
+		}
+		return "", fmt.Errorf("cursor is not signed")
+	}
+
+	key, found := s.keys[keyID]
+	if !found {
+		return "", fmt.Errorf("cursor signed with unknown key %q", keyID)
+	}
+	if !key.NotAfter.IsZero() && time.Now().After(key.NotAfter) {
+		return "", fmt.Errorf("cursor signed with key %q which expired at %s", keyID, key.NotAfter)
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(cursorSignature(key, opaqueCursor))) {
+		return "", fmt.Errorf("invalid cursor signature")
+	}
+
+	return opaqueCursor, nil
+}
+
+func cursorSignature(key CursorSigningKey, opaqueCursor string) string {
+	mac := hmac.New(sha256.New, key.Secret)
+	mac.Write([]byte(key.ID))
+	mac.Write([]byte{'.'})
+	mac.Write([]byte(opaqueCursor))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// splitCursorSignature separates a signed cursor in its parts, opaque cursors never
+// contain a `.` so unsigned cursors are returned as-is.
+func splitCursorSignature(in string) (opaqueCursor, keyID, signature string, signed bool) {
+	parts := strings.SplitN(in, ".", 3)
+	if len(parts) != 3 {
+		return in, "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
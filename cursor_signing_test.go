@@ -0,0 +1,95 @@
+package firehose
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorSigner(t *testing.T) {
+	opaqueCursor := (&bstream.Cursor{
+		Step:      bstream.StepNew,
+		Block:     bstream.NewBlockRef("12b", 12),
+		HeadBlock: bstream.NewBlockRef("12b", 12),
+		LIB:       bstream.NewBlockRef("10a", 10),
+	}).ToOpaque()
+
+	oldKey := CursorSigningKey{ID: "k1", Secret: []byte("old secret")}
+	newKey := CursorSigningKey{ID: "k2", Secret: []byte("new secret")}
+
+	oldSigner, err := NewCursorSigner([]CursorSigningKey{oldKey}, false)
+	require.NoError(t, err)
+	signedWithOld := oldSigner.Sign(opaqueCursor)
+
+	gracefulKey := oldKey
+	gracefulKey.NotAfter = time.Now().Add(time.Hour)
+	expiredKey := oldKey
+	expiredKey.NotAfter = time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name        string
+		keys        []CursorSigningKey
+		unsigned    bool
+		cursor      string
+		expectError bool
+	}{
+		{"signed with active key", []CursorSigningKey{oldKey}, false, signedWithOld, false},
+		{"signed with rotated key in grace window", []CursorSigningKey{newKey, gracefulKey}, false, signedWithOld, false},
+		{"signed with rotated key after grace window", []CursorSigningKey{newKey, expiredKey}, false, signedWithOld, true},
+		{"signed with unknown key", []CursorSigningKey{newKey}, false, signedWithOld, true},
+		{"tampered", []CursorSigningKey{oldKey}, false, signedWithOld[:len(signedWithOld)-2] + "xx", true},
+		{"unsigned accepted", []CursorSigningKey{newKey}, true, opaqueCursor, false},
+		{"unsigned rejected", []CursorSigningKey{newKey}, false, opaqueCursor, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			signer, err := NewCursorSigner(test.keys, test.unsigned)
+			require.NoError(t, err)
+
+			out, err := signer.Verify(test.cursor)
+			if test.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, opaqueCursor, out)
+		})
+	}
+}
+
+func TestStreamFactoryCursorSigning(t *testing.T) {
+	signer, err := NewCursorSigner([]CursorSigningKey{{ID: "k1", Secret: []byte("secret")}}, false)
+	require.NoError(t, err)
+
+	sf := NewStreamFactory(nil, nil, nil, nil, WithCursorSigner(signer))
+	cursor := &bstream.Cursor{
+		Step:      bstream.StepNew,
+		Block:     bstream.NewBlockRef("12b", 12),
+		HeadBlock: bstream.NewBlockRef("12b", 12),
+		LIB:       bstream.NewBlockRef("10a", 10),
+	}
+
+	decoded, err := sf.DecodeCursor(sf.SignCursor(cursor))
+	require.NoError(t, err)
+	assert.True(t, cursor.Equals(decoded))
+
+	_, err = sf.DecodeCursor(cursor.ToOpaque())
+	var errInvalidCursor *ErrInvalidCursor
+	assert.ErrorAs(t, err, &errInvalidCursor)
+
+	info, err := DecodeCursor(sf.SignCursor(cursor))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(12), info.Block.Num())
+}
+
+func TestCursorSigningKeyRedacted(t *testing.T) {
+	out, err := json.Marshal(CursorSigningKey{ID: "k1", Secret: []byte("s3cr3t-value")})
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "s3cr3t-value")
+	assert.Contains(t, string(out), "redacted")
+}
@@ -0,0 +1,52 @@
+package firehose
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/streamingfast/opaque"
+)
+
+const descendingCursorPrefix = "d:"
+
+// EncodeDescendingCursor wraps the cursor of a block sent by a descending order request,
+// so that it cannot be mistaken for the cursor of an ascending one: the same block
+// resumes at N-1 in descending order but at N+1 in ascending order.
+func EncodeDescendingCursor(cursor string) string {
+	return opaque.EncodeString(descendingCursorPrefix + cursor)
+}
+
+// DecodeDescendingCursor returns the cursor wrapped by a descending order cursor
+func DecodeDescendingCursor(in string) (cursor string, err error) {
+	payload, err := opaque.DecodeToString(in)
+	if err != nil {
+		return "", fmt.Errorf("unable to decode: %w", err)
+	}
+	if !strings.HasPrefix(payload, descendingCursorPrefix) {
+		return "", fmt.Errorf("not a descending cursor")
+	}
+	return strings.TrimPrefix(payload, descendingCursorPrefix), nil
+}
+
+// IsDescendingCursor returns true when `in` was issued by a descending order request,
+// multi-range cursors being looked through.
+func IsDescendingCursor(in string) bool {
+	if _, cursor, err := DecodeSegmentCursor(in); err == nil {
+		in = cursor
+	}
+	_, err := DecodeDescendingCursor(in)
+	return err == nil
+}
+
+// unwrapCursor returns the block cursor wrapped by multi-range and descending order
+// cursors, regular cursors being returned as-is.
+func unwrapCursor(in string) (string, error) {
+	cursor, err := unwrapSegmentCursor(in)
+	if err != nil {
+		return "", err
+	}
+	if inner, err := DecodeDescendingCursor(cursor); err == nil {
+		return inner, nil
+	}
+	return cursor, nil
+}
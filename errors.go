@@ -0,0 +1,291 @@
+package firehose
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/bstream/stream"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain is the `domain` of the `google.rpc.ErrorInfo` details attached to the
+// errors returned to clients. Clients should branch on the `reason` of those details
+// rather than on error messages.
+const ErrorDomain = "firehose.streamingfast.io"
+
+const (
+	ReasonInvalidCursor       = "INVALID_CURSOR"
+	ReasonCursorOnUnknownFork = "CURSOR_ON_UNKNOWN_FORK"
+	ReasonRangeNotAvailable   = "RANGE_NOT_AVAILABLE"
+	ReasonTransformRejected   = "TRANSFORM_REJECTED"
+	ReasonStoreUnavailable    = "STORE_UNAVAILABLE"
+	ReasonClientTooSlow       = "CLIENT_TOO_SLOW"
+	ReasonServerDraining      = "SERVER_DRAINING"
+	ReasonPolicyViolation     = "POLICY_VIOLATION"
+	ReasonPolicyLimitReached  = "POLICY_LIMIT_REACHED"
+	ReasonQuotaExceeded       = "QUOTA_EXCEEDED"
+	ReasonStreamCanceled      = "STREAM_CANCELED"
+	ReasonSendFailed          = "SEND_FAILED"
+)
+
+// NewStatusWithReason builds a gRPC status carrying an `ErrorInfo` detail with the given
+// reason and metadata under ErrorDomain.
+func NewStatusWithReason(code codes.Code, reason string, message string, metadata map[string]string) *status.Status {
+	st := status.New(code, message)
+	withDetails, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   ErrorDomain,
+		Metadata: metadata,
+	})
+	if err != nil {
+		return st
+	}
+	return withDetails
+}
+
+// ErrInvalidCursor is returned when a cursor sent by the client cannot be decoded.
+type ErrInvalidCursor struct {
+	Cursor string
+	inner  error
+}
+
+func NewErrInvalidCursor(cursor string, inner error) *ErrInvalidCursor {
+	return &ErrInvalidCursor{Cursor: cursor, inner: inner}
+}
+
+func (e *ErrInvalidCursor) Error() string {
+	return fmt.Sprintf("invalid cursor %q: %s", e.Cursor, e.inner)
+}
+
+func (e *ErrInvalidCursor) Unwrap() error { return e.inner }
+
+func (e *ErrInvalidCursor) GRPCStatus() *status.Status {
+	return NewStatusWithReason(codes.InvalidArgument, ReasonInvalidCursor, e.Error(), map[string]string{"cursor": e.Cursor})
+}
+
+// ErrCursorOnUnknownFork is returned when the block of a valid cursor cannot be linked
+// to the canonical chain, most likely because it was on a fork that is not known anymore.
+// When known, LastSafeBlock is the last final block of the cursor and SafeCursor a cursor
+// on it: the client must roll back its state to that block and resume from that cursor.
+type ErrCursorOnUnknownFork struct {
+	Block         bstream.BlockRef
+	LastSafeBlock bstream.BlockRef
+	SafeCursor    string
+	inner         error
+}
+
+func NewErrCursorOnUnknownFork(block bstream.BlockRef, inner error) *ErrCursorOnUnknownFork {
+	return &ErrCursorOnUnknownFork{Block: block, inner: inner}
+}
+
+func (e *ErrCursorOnUnknownFork) Error() string {
+	return fmt.Sprintf("cursor block %s is on an unknown fork: %s", e.Block, e.inner)
+}
+
+func (e *ErrCursorOnUnknownFork) Unwrap() error { return e.inner }
+
+// IsUnresolvedCursorError returns true when `err`, returned by running a stream created
+// by StreamFactory.New from a cursor, reports that the block of the cursor could not be
+// linked to the canonical chain. New rejects the other invalid arguments before the
+// stream runs, so bstream only returns its stream.ErrInvalidArg for that case.
+func IsUnresolvedCursorError(err error) bool {
+	var errInvalidArg *stream.ErrInvalidArg
+	return errors.As(err, &errInvalidArg)
+}
+
+func (e *ErrCursorOnUnknownFork) GRPCStatus() *status.Status {
+	metadata := map[string]string{
+		"block_num": fmt.Sprintf("%d", e.Block.Num()),
+		"block_id":  e.Block.ID(),
+	}
+	if e.LastSafeBlock != nil {
+		metadata["last_safe_block_num"] = fmt.Sprintf("%d", e.LastSafeBlock.Num())
+		metadata["last_safe_block_id"] = e.LastSafeBlock.ID()
+		metadata["safe_cursor"] = e.SafeCursor
+	}
+	return NewStatusWithReason(codes.FailedPrecondition, ReasonCursorOnUnknownFork, e.Error(), metadata)
+}
+
+// ErrRangeNotAvailable is returned when the requested blocks cannot be served by this
+// instance, for example because they are not merged yet.
+type ErrRangeNotAvailable struct {
+	StartBlock uint64
+	StopBlock  uint64
+	Reason     string
+}
+
+func NewErrRangeNotAvailable(startBlock, stopBlock uint64, reason string) *ErrRangeNotAvailable {
+	return &ErrRangeNotAvailable{StartBlock: startBlock, StopBlock: stopBlock, Reason: reason}
+}
+
+func (e *ErrRangeNotAvailable) Error() string {
+	return fmt.Sprintf("block range %d-%d not available: %s", e.StartBlock, e.StopBlock, e.Reason)
+}
+
+func (e *ErrRangeNotAvailable) GRPCStatus() *status.Status {
+	return NewStatusWithReason(codes.OutOfRange, ReasonRangeNotAvailable, e.Error(), map[string]string{
+		"start_block": fmt.Sprintf("%d", e.StartBlock),
+		"stop_block":  fmt.Sprintf("%d", e.StopBlock),
+	})
+}
+
+// ErrTransformRejected is returned when the transforms of a request cannot be applied.
+type ErrTransformRejected struct {
+	inner error
+}
+
+func NewErrTransformRejected(inner error) *ErrTransformRejected {
+	return &ErrTransformRejected{inner: inner}
+}
+
+func (e *ErrTransformRejected) Error() string {
+	return fmt.Sprintf("transforms rejected: %s", e.inner)
+}
+
+func (e *ErrTransformRejected) Unwrap() error { return e.inner }
+
+func (e *ErrTransformRejected) GRPCStatus() *status.Status {
+	return NewStatusWithReason(codes.InvalidArgument, ReasonTransformRejected, e.Error(), nil)
+}
+
+// ErrStoreUnavailable is returned when a blocks store cannot be reached. Retrying later
+// is expected to succeed.
+type ErrStoreUnavailable struct {
+	Store string
+	inner error
+}
+
+func NewErrStoreUnavailable(store string, inner error) *ErrStoreUnavailable {
+	return &ErrStoreUnavailable{Store: store, inner: inner}
+}
+
+func (e *ErrStoreUnavailable) Error() string {
+	return fmt.Sprintf("%s store unavailable: %s", e.Store, e.inner)
+}
+
+func (e *ErrStoreUnavailable) Unwrap() error { return e.inner }
+
+func (e *ErrStoreUnavailable) GRPCStatus() *status.Status {
+	return NewStatusWithReason(codes.Unavailable, ReasonStoreUnavailable, fmt.Sprintf("%s store unavailable", e.Store), map[string]string{"store": e.Store})
+}
+
+// ErrClientTooSlow is returned when a client does not consume its stream fast enough
+// and gets disconnected. LastCursor, when set, is the cursor of the last block
+// successfully sent.
+type ErrClientTooSlow struct {
+	LastCursor string
+	Reason     string
+}
+
+func NewErrClientTooSlow(lastCursor string, reason string) *ErrClientTooSlow {
+	return &ErrClientTooSlow{LastCursor: lastCursor, Reason: reason}
+}
+
+func (e *ErrClientTooSlow) Error() string {
+	return fmt.Sprintf("client too slow: %s", e.Reason)
+}
+
+func (e *ErrClientTooSlow) GRPCStatus() *status.Status {
+	return NewStatusWithReason(codes.ResourceExhausted, ReasonClientTooSlow, e.Error(), map[string]string{"last_cursor": e.LastCursor})
+}
+
+// ErrServerDraining is returned when the server shuts down, streams must be resumed on
+// another instance using the last cursor received.
+type ErrServerDraining struct{}
+
+func NewErrServerDraining() *ErrServerDraining {
+	return &ErrServerDraining{}
+}
+
+func (e *ErrServerDraining) Error() string {
+	return "server is shutting down, reconnect to resume from last cursor"
+}
+
+func (e *ErrServerDraining) GRPCStatus() *status.Status {
+	return NewStatusWithReason(codes.Unavailable, ReasonServerDraining, e.Error(), nil)
+}
+
+// ErrPolicyViolation is returned when a request is not allowed by the policy of the
+// caller's tier, for example because its block range is too wide.
+type ErrPolicyViolation struct {
+	Tier   string
+	Limit  string
+	Reason string
+}
+
+func NewErrPolicyViolation(tier, limit, reason string) *ErrPolicyViolation {
+	return &ErrPolicyViolation{Tier: tier, Limit: limit, Reason: reason}
+}
+
+func (e *ErrPolicyViolation) Error() string {
+	return fmt.Sprintf("request not allowed for tier %q: %s", e.Tier, e.Reason)
+}
+
+func (e *ErrPolicyViolation) GRPCStatus() *status.Status {
+	return NewStatusWithReason(codes.PermissionDenied, ReasonPolicyViolation, e.Error(), map[string]string{"tier": e.Tier, "limit": e.Limit})
+}
+
+// ErrPolicyLimitReached is returned when a stream is terminated because it consumed
+// everything the policy of the caller's tier allows, like its maximum duration.
+type ErrPolicyLimitReached struct {
+	Tier   string
+	Limit  string
+	Reason string
+}
+
+func NewErrPolicyLimitReached(tier, limit, reason string) *ErrPolicyLimitReached {
+	return &ErrPolicyLimitReached{Tier: tier, Limit: limit, Reason: reason}
+}
+
+func (e *ErrPolicyLimitReached) Error() string {
+	return fmt.Sprintf("limit reached for tier %q: %s", e.Tier, e.Reason)
+}
+
+func (e *ErrPolicyLimitReached) GRPCStatus() *status.Status {
+	return NewStatusWithReason(codes.ResourceExhausted, ReasonPolicyLimitReached, e.Error(), map[string]string{"tier": e.Tier, "limit": e.Limit})
+}
+
+// ErrQuotaExceeded is returned when the caller used all of a quota of its plan, either
+// when the request is received or while its stream is running.
+type ErrQuotaExceeded struct {
+	Quota string
+	Limit uint64
+	Used  uint64
+}
+
+func NewErrQuotaExceeded(quota string, limit, used uint64) *ErrQuotaExceeded {
+	return &ErrQuotaExceeded{Quota: quota, Limit: limit, Used: used}
+}
+
+func (e *ErrQuotaExceeded) Error() string {
+	return fmt.Sprintf("quota %q exceeded: used %d of %d", e.Quota, e.Used, e.Limit)
+}
+
+func (e *ErrQuotaExceeded) GRPCStatus() *status.Status {
+	return NewStatusWithReason(codes.ResourceExhausted, ReasonQuotaExceeded, e.Error(), map[string]string{
+		"quota": e.Quota,
+		"limit": fmt.Sprintf("%d", e.Limit),
+		"used":  fmt.Sprintf("%d", e.Used),
+	})
+}
+
+// ErrStreamCanceled is returned when an operator canceled the stream, Reason being the
+// explanation they gave.
+type ErrStreamCanceled struct {
+	Reason string
+}
+
+func NewErrStreamCanceled(reason string) *ErrStreamCanceled {
+	return &ErrStreamCanceled{Reason: reason}
+}
+
+func (e *ErrStreamCanceled) Error() string {
+	return fmt.Sprintf("stream canceled by operator: %s", e.Reason)
+}
+
+func (e *ErrStreamCanceled) GRPCStatus() *status.Status {
+	return NewStatusWithReason(codes.Aborted, ReasonStreamCanceled, e.Error(), map[string]string{"reason": e.Reason})
+}
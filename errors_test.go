@@ -0,0 +1,126 @@
+package firehose
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/streamingfast/bstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorsToStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedCode   codes.Code
+		expectedReason string
+		expectedMeta   map[string]string
+	}{
+		{
+			"invalid cursor",
+			NewErrInvalidCursor("abc", fmt.Errorf("unable to decode")),
+			codes.InvalidArgument,
+			ReasonInvalidCursor,
+			map[string]string{"cursor": "abc"},
+		},
+		{
+			"cursor on unknown fork",
+			NewErrCursorOnUnknownFork(bstream.NewBlockRef("10b", 10), fmt.Errorf("cannot resolve cursor")),
+			codes.FailedPrecondition,
+			ReasonCursorOnUnknownFork,
+			map[string]string{"block_num": "10", "block_id": "10b"},
+		},
+		{
+			"cursor on unknown fork with safe block",
+			&ErrCursorOnUnknownFork{Block: bstream.NewBlockRef("10b", 10), LastSafeBlock: bstream.NewBlockRef("8a", 8), SafeCursor: "safe", inner: fmt.Errorf("missing link")},
+			codes.FailedPrecondition,
+			ReasonCursorOnUnknownFork,
+			map[string]string{"block_num": "10", "block_id": "10b", "last_safe_block_num": "8", "last_safe_block_id": "8a", "safe_cursor": "safe"},
+		},
+		{
+			"range not available",
+			NewErrRangeNotAvailable(100, 199, "not merged yet"),
+			codes.OutOfRange,
+			ReasonRangeNotAvailable,
+			map[string]string{"start_block": "100", "stop_block": "199"},
+		},
+		{
+			"transform rejected",
+			NewErrTransformRejected(fmt.Errorf("unknown transform")),
+			codes.InvalidArgument,
+			ReasonTransformRejected,
+			nil,
+		},
+		{
+			"store unavailable",
+			NewErrStoreUnavailable("merged blocks", fmt.Errorf("connection refused")),
+			codes.Unavailable,
+			ReasonStoreUnavailable,
+			map[string]string{"store": "merged blocks"},
+		},
+		{
+			"client too slow",
+			NewErrClientTooSlow("cursor", "lagging behind"),
+			codes.ResourceExhausted,
+			ReasonClientTooSlow,
+			map[string]string{"last_cursor": "cursor"},
+		},
+		{
+			"policy violation",
+			NewErrPolicyViolation("free", "max_block_range", "too wide"),
+			codes.PermissionDenied,
+			ReasonPolicyViolation,
+			map[string]string{"tier": "free", "limit": "max_block_range"},
+		},
+		{
+			"policy limit reached",
+			NewErrPolicyLimitReached("free", "max_blocks", "too many blocks"),
+			codes.ResourceExhausted,
+			ReasonPolicyLimitReached,
+			map[string]string{"tier": "free", "limit": "max_blocks"},
+		},
+		{
+			"server draining",
+			NewErrServerDraining(),
+			codes.Unavailable,
+			ReasonServerDraining,
+			nil,
+		},
+		{
+			"quota exceeded",
+			NewErrQuotaExceeded("monthly_blocks", 1000, 1002),
+			codes.ResourceExhausted,
+			ReasonQuotaExceeded,
+			map[string]string{"quota": "monthly_blocks", "limit": "1000", "used": "1002"},
+		},
+		{
+			"stream canceled",
+			NewErrStreamCanceled("abusive usage"),
+			codes.Aborted,
+			ReasonStreamCanceled,
+			map[string]string{"reason": "abusive usage"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			st, ok := status.FromError(test.err)
+			require.True(t, ok)
+			assert.Equal(t, test.expectedCode, st.Code())
+
+			require.Len(t, st.Details(), 1)
+			info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+			require.True(t, ok)
+			assert.Equal(t, ErrorDomain, info.Domain)
+			assert.Equal(t, test.expectedReason, info.Reason)
+			assert.Equal(t, len(test.expectedMeta), len(info.Metadata))
+			for k, v := range test.expectedMeta {
+				assert.Equal(t, v, info.Metadata[k])
+			}
+		})
+	}
+}
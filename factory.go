@@ -4,10 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/streamingfast/dauth"
 	"github.com/streamingfast/derr"
-	"github.com/streamingfast/dmetering"
+	"github.com/streamingfast/firehose/metrics"
 
 	"github.com/streamingfast/bstream"
 	"github.com/streamingfast/bstream/hub"
@@ -15,7 +16,9 @@ import (
 	"github.com/streamingfast/bstream/transform"
 	"github.com/streamingfast/dstore"
 	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -61,27 +64,27 @@ func (g *BlockGetter) Get(
 
 	// check for block in live segment: Hub
 	if g.hub != nil && num > g.hub.LowestBlockNum() {
+		start := time.Now()
 		if blk := g.hub.GetBlock(num, id); blk != nil {
+			observeBlockLookup(BlockSourceHub, blockLookupFound, start)
 			reqLogger.Info("single block request", zap.String("source", "hub"), zap.Bool("found", true))
-			return blk, nil
+			return blk, MeterBlockRead(ctx, BlockSourceHub, blk)
 		}
+		observeBlockLookup(BlockSourceHub, blockLookupNotFound, start)
 		reqLogger.Info("single block request", zap.String("source", "hub"), zap.Bool("found", false))
 		return nil, status.Error(codes.NotFound, "live block not found in hub")
 	}
 
-	mergedBlocksStore := g.mergedBlocksStore
-	if clonable, ok := mergedBlocksStore.(dstore.Clonable); ok {
-		var err error
-		mergedBlocksStore, err = clonable.Clone(ctx)
-		if err != nil {
-			return nil, err
-		}
-		mergedBlocksStore.SetMeter(dmetering.GetBytesMeter(ctx))
+	start := time.Now()
+	mergedBlocksStore, err := requestStore(ctx, g.mergedBlocksStore, BlockSourceMergedBlocks)
+	if err != nil {
+		observeBlockLookup(BlockSourceMergedBlocks, blockLookupError, start)
+		return nil, err
 	}
 
 	// check for block in mergedBlocksStore
 	err = derr.RetryContext(ctx, 3, func(ctx context.Context) error {
-		blk, err := bstream.FetchBlockFromMergedBlocksStore(ctx, num, mergedBlocksStore)
+		blk, err := fetchMergedBlock(ctx, num, mergedBlocksStore)
 		if err != nil {
 			if errors.Is(err, dstore.ErrNotFound) {
 				return derr.NewFatalError(err)
@@ -93,27 +96,27 @@ func (g *BlockGetter) Get(
 			out = blk
 			return nil
 		}
-		return derr.NewFatalError(fmt.Errorf("wrong block: found %s, expecting %s", blk.Id, id))
+		return derr.NewFatalError(fmt.Errorf("%w: found %s, expecting %s", errWrongBlock, blk.Id, id))
 	})
+	observeBlockLookup(BlockSourceMergedBlocks, blockLookupOutcome(out, err), start)
 	if out != nil {
-		return out, nil
+		return out, MeterBlockRead(ctx, BlockSourceMergedBlocks, out)
 	}
 
 	// check for block in forkedBlocksStore
 	if g.forkedBlocksStore != nil {
-		forkedBlocksStore := g.forkedBlocksStore
-		if clonable, ok := forkedBlocksStore.(dstore.Clonable); ok {
-			var err error
-			forkedBlocksStore, err = clonable.Clone(ctx)
-			if err != nil {
-				return nil, err
-			}
-			forkedBlocksStore.SetMeter(dmetering.GetBytesMeter(ctx))
+		start := time.Now()
+		forkedBlocksStore, err := requestStore(ctx, g.forkedBlocksStore, BlockSourceForkedBlocks)
+		if err != nil {
+			observeBlockLookup(BlockSourceForkedBlocks, blockLookupError, start)
+			return nil, err
 		}
 
-		if blk, _ := bstream.FetchBlockFromOneBlockStore(ctx, num, id, forkedBlocksStore); blk != nil {
+		blk, forkedErr := bstream.FetchBlockFromOneBlockStore(ctx, num, id, forkedBlocksStore)
+		observeBlockLookup(BlockSourceForkedBlocks, blockLookupOutcome(blk, forkedErr), start)
+		if blk != nil {
 			reqLogger.Info("single block request", zap.String("source", "forked_blocks"), zap.Bool("found", true))
-			return blk, nil
+			return blk, MeterBlockRead(ctx, BlockSourceForkedBlocks, blk)
 		}
 	}
 
@@ -121,11 +124,107 @@ func (g *BlockGetter) Get(
 	return nil, status.Error(codes.NotFound, "block not found in files")
 }
 
+var errWrongBlock = errors.New("wrong block")
+
+// fetchMergedBlock reads block `num` from its merged blocks file, returning
+// dstore.ErrNotFound when the file or the block does not exist. Unlike
+// bstream.FetchBlockFromMergedBlocksStore, it leaves no file source running once it
+// returns.
+func fetchMergedBlock(ctx context.Context, num uint64, store dstore.Store) (*bstream.Block, error) {
+	var out *bstream.Block
+	err := readMergedBlocks(ctx, store, lowBoundary(num, mergedBlocksBundleSize), func(blk *bstream.Block) error {
+		if blk.Number < num {
+			return nil
+		}
+		if blk.Number == num {
+			out = blk
+		}
+		return dstore.StopIteration
+	})
+	if err != nil {
+		var rangeErr *ErrRangeNotAvailable
+		if errors.As(err, &rangeErr) {
+			return nil, dstore.ErrNotFound
+		}
+		return nil, err
+	}
+	if out == nil {
+		return nil, dstore.ErrNotFound
+	}
+	return out, nil
+}
+
+// Outcomes of a BlockGetter lookup in one of its sources, as labeled in its metrics
+const (
+	blockLookupFound    = "found"
+	blockLookupNotFound = "not_found"
+	blockLookupWrongID  = "wrong_id"
+	blockLookupError    = "error"
+)
+
+func blockLookupOutcome(blk *bstream.Block, err error) string {
+	switch {
+	case blk != nil:
+		return blockLookupFound
+	case err == nil, errors.Is(err, dstore.ErrNotFound):
+		return blockLookupNotFound
+	case errors.Is(err, errWrongBlock):
+		return blockLookupWrongID
+	default:
+		return blockLookupError
+	}
+}
+
+func observeBlockLookup(source BlockSource, outcome string, start time.Time) {
+	metrics.BlockGetterLookups.Inc(string(source), outcome)
+	metrics.BlockGetterLookupLatency.ObserveSince(start, string(source), outcome)
+}
+
 type StreamFactory struct {
 	mergedBlocksStore dstore.Store
 	forkedBlocksStore dstore.Store
 	hub               *hub.ForkableHub
 	transformRegistry *transform.Registry
+
+	backfillWorkers      int
+	backfillMemoryBudget *semaphore.Weighted
+	backfillBudgetSize   int64
+	backfillStreamBudget int64
+
+	cursorSigner *CursorSigner
+}
+
+type StreamFactoryOption func(*StreamFactory)
+
+// WithParallelBackfill enables the parallel backfill engine for bounded final-blocks-only
+// requests. Each request reads up to `workers` merged blocks files concurrently, and the
+// decoded blocks held in memory by all the backfills of this factory are bounded by
+// `memoryBudget` bytes.
+func WithParallelBackfill(workers int, memoryBudget int64) StreamFactoryOption {
+	return func(sf *StreamFactory) {
+		if workers <= 0 || memoryBudget <= 0 {
+			return
+		}
+		sf.backfillWorkers = workers
+		sf.backfillMemoryBudget = semaphore.NewWeighted(memoryBudget)
+		sf.backfillBudgetSize = memoryBudget
+	}
+}
+
+// WithParallelBackfillStreamBudget bounds the bytes of decoded blocks a single backfill
+// holds in memory, so that a client not reading its stream cannot take the memory budget
+// of the other backfills. It defaults to a quarter of the parallel backfill memory budget.
+func WithParallelBackfillStreamBudget(streamBudget int64) StreamFactoryOption {
+	return func(sf *StreamFactory) {
+		sf.backfillStreamBudget = streamBudget
+	}
+}
+
+// WithCursorSigner signs the cursors sent to clients and verifies the ones they send back.
+func WithCursorSigner(signer *CursorSigner) StreamFactoryOption {
+	return func(sf *StreamFactory) {
+		sf.cursorSigner = signer
+	}
 }
 
 func NewStreamFactory(
@@ -133,13 +232,20 @@ func NewStreamFactory(
 	forkedBlocksStore dstore.Store,
 	hub *hub.ForkableHub,
 	transformRegistry *transform.Registry,
+	opts ...StreamFactoryOption,
 ) *StreamFactory {
-	return &StreamFactory{
+	sf := &StreamFactory{
 		mergedBlocksStore: mergedBlocksStore,
 		forkedBlocksStore: forkedBlocksStore,
 		hub:               hub,
 		transformRegistry: transformRegistry,
 	}
+
+	for _, opt := range opts {
+		opt(sf)
+	}
+
+	return sf
 }
 
 func (sf *StreamFactory) New(
@@ -163,7 +269,7 @@ func (sf *StreamFactory) New(
 	preprocFunc, blockIndexProvider, desc, err := sf.transformRegistry.BuildFromTransforms(request.Transforms)
 	if err != nil {
 		reqLogger.Error("cannot process incoming blocks request transforms", zap.Error(err))
-		return nil, fmt.Errorf("building from transforms: %w", err)
+		return nil, NewErrTransformRejected(err)
 	}
 	if preprocFunc != nil {
 		options = append(options, stream.WithPreprocessFunc(preprocFunc, StreamMergedBlocksPreprocThreads))
@@ -198,42 +304,304 @@ func (sf *StreamFactory) New(
 
 	reqLogger.Info("processing incoming blocks request", fields...)
 
+	// the arguments rejected by bstream when the stream starts are rejected here instead,
+	// leaving stream.ErrInvalidArg to report an unresolved cursor, see IsUnresolvedCursorError
+	startBlockNum := request.StartBlockNum
+	if startBlockNum < 0 && sf.hub != nil {
+		startBlockNum = 0
+		if head := sf.hub.HeadNum(); head > uint64(-request.StartBlockNum) {
+			startBlockNum = int64(head - uint64(-request.StartBlockNum))
+		}
+	}
+	if request.StopBlockNum > 0 && startBlockNum >= 0 {
+		absoluteStartBlockNum := uint64(startBlockNum)
+		if absoluteStartBlockNum < bstream.GetProtocolFirstStreamableBlock {
+			absoluteStartBlockNum = bstream.GetProtocolFirstStreamableBlock
+		}
+		if absoluteStartBlockNum > request.StopBlockNum {
+			return nil, status.Errorf(codes.InvalidArgument, "start block %d is after stop block %d", absoluteStartBlockNum, request.StopBlockNum)
+		}
+	}
+
 	if request.Cursor != "" {
-		cur, err := bstream.CursorFromOpaque(request.Cursor)
+		cur, err := sf.DecodeCursor(request.Cursor)
 		if err != nil {
-			return nil, status.Errorf(codes.InvalidArgument, "invalid start cursor %q: %s", request.Cursor, err)
+			return nil, err
+		}
+		if request.FinalBlocksOnly && !cur.IsOnFinalBlock() {
+			return nil, status.Error(codes.InvalidArgument, "cannot stream with final-blocks-only from this non-final cursor")
 		}
 
 		options = append(options, stream.WithCursor(cur))
 	}
 
-	forkedBlocksStore := sf.forkedBlocksStore
-	if clonable, ok := forkedBlocksStore.(dstore.Clonable); ok {
-		var err error
-		forkedBlocksStore, err = clonable.Clone(ctx)
-		if err != nil {
-			return nil, err
-		}
-		forkedBlocksStore.SetMeter(dmetering.GetBytesMeter(ctx))
+	forkedBlocksStore, err := requestStore(ctx, sf.forkedBlocksStore, BlockSourceForkedBlocks)
+	if err != nil {
+		return nil, err
 	}
 
-	mergedBlocksStore := sf.mergedBlocksStore
-	if clonable, ok := mergedBlocksStore.(dstore.Clonable); ok {
-		var err error
-		mergedBlocksStore, err = clonable.Clone(ctx)
-		if err != nil {
-			return nil, err
-		}
-		mergedBlocksStore.SetMeter(dmetering.GetBytesMeter(ctx))
+	mergedBlocksStore, err := requestStore(ctx, sf.mergedBlocksStore, BlockSourceMergedBlocks)
+	if err != nil {
+		return nil, err
 	}
 
 	str := stream.New(
 		forkedBlocksStore,
 		mergedBlocksStore,
 		sf.hub,
-		request.StartBlockNum,
+		startBlockNum,
 		handler,
 		options...)
 
 	return str, nil
 }
+
+// SignCursor returns the opaque form of `cursor` sent to clients, signed when a cursor
+// signer is configured.
+func (sf *StreamFactory) SignCursor(cursor *bstream.Cursor) string {
+	if sf.cursorSigner == nil {
+		return cursor.ToOpaque()
+	}
+	return sf.cursorSigner.Sign(cursor.ToOpaque())
+}
+
+// DecodeCursor decodes a cursor sent by a client, verifying its signature when a cursor
+// signer is configured. Multi-range and descending order cursors decode to the cursor of
+// their block. Errors are of type ErrInvalidCursor.
+func (sf *StreamFactory) DecodeCursor(in string) (*bstream.Cursor, error) {
+	opaqueCursor, err := unwrapCursor(in)
+	if err != nil {
+		return nil, NewErrInvalidCursor(in, err)
+	}
+
+	if sf.cursorSigner != nil {
+		opaqueCursor, err = sf.cursorSigner.Verify(opaqueCursor)
+		if err != nil {
+			return nil, NewErrInvalidCursor(in, err)
+		}
+	} else {
+		opaqueCursor, _, _, _ = splitCursorSignature(opaqueCursor)
+	}
+
+	cursor, err := bstream.CursorFromOpaque(opaqueCursor)
+	if err != nil {
+		return nil, NewErrInvalidCursor(in, err)
+	}
+	return cursor, nil
+}
+
+// HeadNum returns the current head block number of the hub, or 0 when live blocks
+// are not available.
+func (sf *StreamFactory) HeadNum() uint64 {
+	return sf.hub.HeadNum()
+}
+
+// HeadAndLIBNum returns the current head and last irreversible block numbers of the
+// hub, both 0 when live blocks are not available.
+func (sf *StreamFactory) HeadAndLIBNum() (headNum uint64, libNum uint64) {
+	headNum, _, _, libNum, err := sf.hub.HeadInfo()
+	if err != nil {
+		return 0, 0
+	}
+	return headNum, libNum
+}
+
+// parentLookupDepth is how many block numbers below a block ParentRef looks at in the
+// hub, each lookup going through all the blocks it holds.
+const parentLookupDepth = 16
+
+// ParentRef returns the reference of the parent of `block` as known by the
+// hub. When the hub is not available or does not hold the parent within
+// parentLookupDepth numbers, the returned reference has the correct ID but a
+// best-effort number.
+func (sf *StreamFactory) ParentRef(block *bstream.Block) bstream.BlockRef {
+	if block.Number == 0 {
+		return bstream.NewBlockRef(block.PreviousId, 0)
+	}
+
+	if sf.hub != nil && sf.hub.IsReady() {
+		lowest := sf.hub.LowestBlockNum()
+		for num := block.Number - 1; num >= lowest && num > 0 && block.Number-num <= parentLookupDepth; num-- {
+			if parent := sf.hub.GetBlock(num, block.PreviousId); parent != nil {
+				return parent.AsRef()
+			}
+		}
+	}
+
+	return bstream.NewBlockRef(block.PreviousId, block.Number-1)
+}
+
+// CanBackfill returns true when the request can be served by the parallel backfill
+// engine: it must be enabled, the request must be bounded and final-blocks-only, it
+// must not rely on a block index and all its blocks must already be merged.
+func (sf *StreamFactory) CanBackfill(ctx context.Context, request *pbfirehose.Request) bool {
+	if sf.backfillWorkers == 0 || !request.FinalBlocksOnly || request.StopBlockNum == 0 || request.StartBlockNum < 0 {
+		return false
+	}
+
+	startBlockNum := uint64(request.StartBlockNum)
+	if request.Cursor != "" {
+		cur, err := sf.DecodeCursor(request.Cursor)
+		if err != nil || !cur.IsOnFinalBlock() {
+			return false
+		}
+		startBlockNum = cur.Block.Num() + 1
+	}
+	if startBlockNum > request.StopBlockNum {
+		return false
+	}
+
+	if sf.transformRegistry != nil && len(request.Transforms) > 0 {
+		_, blockIndexProvider, _, err := sf.transformRegistry.BuildFromTransforms(request.Transforms)
+		if err != nil || blockIndexProvider != nil {
+			return false
+		}
+	}
+
+	exists, err := sf.mergedBlocksStore.FileExists(ctx, mergedFilename(lowBoundary(request.StopBlockNum, mergedBlocksBundleSize)))
+	return err == nil && exists
+}
+
+// NewBackfill creates a Backfill for a request accepted by CanBackfill. The handler
+// receives blocks the same way it would from a stream created by New.
+func (sf *StreamFactory) NewBackfill(
+	ctx context.Context,
+	handler bstream.Handler,
+	request *pbfirehose.Request,
+	decodeBlock bool,
+	logger *zap.Logger) (*Backfill, error) {
+
+	startBlockNum := uint64(request.StartBlockNum)
+	if request.Cursor != "" {
+		cur, err := sf.DecodeCursor(request.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		startBlockNum = cur.Block.Num() + 1
+	}
+
+	return sf.newBackfill(ctx, handler, request, startBlockNum, request.StopBlockNum, false, decodeBlock, logger)
+}
+
+// NewReverseBackfill creates a Backfill that delivers the final blocks of the request
+// from its stop block down to its start block. Only bounded final-blocks-only requests
+// whose stop block is already merged are accepted, live blocks are never served.
+//
+// Cursors are resumed in reverse too: a cursor received for block N means that every
+// block from the stop block down to N was delivered, so sending it back with the same
+// request resumes at block N-1. The cursors of the blocks it delivers must be wrapped
+// with EncodeDescendingCursor, only such cursors are accepted here.
+func (sf *StreamFactory) NewReverseBackfill(
+	ctx context.Context,
+	handler bstream.Handler,
+	request *pbfirehose.Request,
+	decodeBlock bool,
+	logger *zap.Logger) (*Backfill, error) {
+
+	if !request.FinalBlocksOnly {
+		return nil, status.Error(codes.InvalidArgument, "descending order requires final blocks only")
+	}
+	if request.StopBlockNum == 0 || request.StartBlockNum < 0 {
+		return nil, status.Error(codes.InvalidArgument, "descending order requires an absolute start block and a stop block")
+	}
+	if uint64(request.StartBlockNum) > request.StopBlockNum {
+		return nil, status.Errorf(codes.InvalidArgument, "start block %d is after stop block %d", request.StartBlockNum, request.StopBlockNum)
+	}
+
+	startBlockNum := uint64(request.StartBlockNum)
+	stopBlockNum := request.StopBlockNum
+	if request.Cursor != "" {
+		if !IsDescendingCursor(request.Cursor) {
+			return nil, status.Error(codes.InvalidArgument, "cursor was not issued by a descending order request, it would resume in the wrong direction")
+		}
+		cur, err := sf.DecodeCursor(request.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cur.Block.Num() > stopBlockNum {
+			return nil, status.Errorf(codes.InvalidArgument, "cursor block %d is after stop block %d", cur.Block.Num(), stopBlockNum)
+		}
+		if cur.Block.Num() <= startBlockNum {
+			// the start block was the last one to send, nothing is left: an inverted range
+			// makes the backfill read no file and end right away with ErrStopBlockReached,
+			// `stopBlockNum` cannot be set to N-1 as it underflows when N is 0
+			startBlockNum, stopBlockNum = 1, 0
+		} else {
+			stopBlockNum = cur.Block.Num() - 1
+		}
+	}
+
+	exists, err := sf.mergedBlocksStore.FileExists(ctx, mergedFilename(lowBoundary(request.StopBlockNum, mergedBlocksBundleSize)))
+	if err != nil {
+		return nil, NewErrStoreUnavailable("merged blocks", err)
+	}
+	if !exists {
+		return nil, NewErrRangeNotAvailable(uint64(request.StartBlockNum), request.StopBlockNum, "stop block is not merged yet, descending order cannot serve live blocks")
+	}
+
+	return sf.newBackfill(ctx, handler, request, startBlockNum, stopBlockNum, true, decodeBlock, logger)
+}
+
+func (sf *StreamFactory) newBackfill(
+	ctx context.Context,
+	handler bstream.Handler,
+	request *pbfirehose.Request,
+	startBlockNum uint64,
+	stopBlockNum uint64,
+	descending bool,
+	decodeBlock bool,
+	logger *zap.Logger) (*Backfill, error) {
+
+	if startBlockNum < bstream.GetProtocolFirstStreamableBlock {
+		startBlockNum = bstream.GetProtocolFirstStreamableBlock
+	}
+
+	var preprocFunc bstream.PreprocessFunc
+	if sf.transformRegistry != nil {
+		var err error
+		preprocFunc, _, _, err = sf.transformRegistry.BuildFromTransforms(request.Transforms)
+		if err != nil {
+			return nil, NewErrTransformRejected(err)
+		}
+	}
+	if preprocFunc == nil && decodeBlock {
+		preprocFunc = bstreamToProtocolPreprocFunc
+	}
+
+	mergedBlocksStore, err := requestStore(ctx, sf.mergedBlocksStore, BlockSourceMergedBlocks)
+	if err != nil {
+		return nil, err
+	}
+
+	// without parallel backfill configured (only possible in descending order), files are read one at a time
+	workers, memoryBudget, budgetSize := sf.backfillWorkers, sf.backfillMemoryBudget, sf.backfillBudgetSize
+	if memoryBudget == nil {
+		workers, budgetSize = 1, defaultBackfillSegmentSizeEstimate
+		memoryBudget = semaphore.NewWeighted(budgetSize)
+	}
+
+	streamBudgetSize := sf.backfillStreamBudget
+	if streamBudgetSize <= 0 {
+		streamBudgetSize = budgetSize / defaultBackfillStreamBudgetShare
+	}
+	if streamBudgetSize <= 0 || streamBudgetSize > budgetSize {
+		streamBudgetSize = budgetSize
+	}
+
+	return &Backfill{
+		mergedBlocksStore: mergedBlocksStore,
+		handler:           handler,
+		preprocFunc:       preprocFunc,
+		preprocThreads:    StreamMergedBlocksPreprocThreads,
+		startBlockNum:     startBlockNum,
+		stopBlockNum:      stopBlockNum,
+		descending:        descending,
+		workers:           workers,
+		memoryBudget:      memoryBudget,
+		budgetSize:        budgetSize,
+		streamBudget:      semaphore.NewWeighted(streamBudgetSize),
+		streamBudgetSize:  streamBudgetSize,
+		decodedSizeRatio:  atomic.NewFloat64(defaultBackfillDecodedSizeRatio),
+		logger:            logger,
+	}, nil
+}
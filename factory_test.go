@@ -0,0 +1,113 @@
+package firehose
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/bstream/transform"
+	"github.com/streamingfast/dstore"
+	"github.com/streamingfast/firehose/metrics"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func blockLookups(t *testing.T, source BlockSource, outcome string) uint64 {
+	t.Helper()
+
+	out := &dto.Metric{}
+	require.NoError(t, metrics.BlockGetterLookups.Native().WithLabelValues(string(source), outcome).Write(out))
+	return uint64(out.Counter.GetValue())
+}
+
+func TestBlockGetterLookupMetrics(t *testing.T) {
+	mergedStore := dstore.NewMockStore(nil)
+	mergedStore.SetFile("0000000000", []byte(strings.Join([]string{
+		bstream.TestJSONBlockWithLIBNum("00000002a", "00000001a", 1),
+		bstream.TestJSONBlockWithLIBNum("00000003a", "00000002a", 2),
+	}, "\n")))
+	getter := NewBlockGetter(mergedStore, dstore.NewMockStore(nil), nil)
+
+	tests := []struct {
+		name     string
+		num      uint64
+		id       string
+		expected map[BlockSource]string
+	}{
+		{"found", 3, "00000003a", map[BlockSource]string{BlockSourceMergedBlocks: blockLookupFound}},
+		{"wrong id", 3, "00000003b", map[BlockSource]string{BlockSourceMergedBlocks: blockLookupWrongID, BlockSourceForkedBlocks: blockLookupNotFound}},
+		{"not found", 1, "", map[BlockSource]string{BlockSourceMergedBlocks: blockLookupNotFound, BlockSourceForkedBlocks: blockLookupNotFound}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := make(map[BlockSource]uint64)
+			for source, outcome := range test.expected {
+				before[source] = blockLookups(t, source, outcome)
+			}
+
+			blk, err := getter.Get(context.Background(), test.num, test.id, zap.NewNop())
+			if test.expected[BlockSourceMergedBlocks] == blockLookupFound {
+				require.NoError(t, err)
+				assert.Equal(t, test.id, blk.Id)
+			} else {
+				require.Error(t, err)
+			}
+			assertNoFileSource(t)
+
+			for source, outcome := range test.expected {
+				assert.Equal(t, before[source]+1, blockLookups(t, source, outcome), "%s %s", source, outcome)
+			}
+		})
+	}
+}
+
+// assertNoFileSource checks that no bstream file source is left running, they race with
+// the blocks read by the next test.
+func assertNoFileSource(t *testing.T) {
+	t.Helper()
+
+	buf := make([]byte, 1<<20)
+	assert.NotContains(t, string(buf[:runtime.Stack(buf, true)]), "bstream.(*FileSource)")
+}
+
+func TestBlockLookupOutcome(t *testing.T) {
+	assert.Equal(t, blockLookupFound, blockLookupOutcome(&bstream.Block{Id: "00000003a", Number: 3}, nil))
+	assert.Equal(t, blockLookupNotFound, blockLookupOutcome(nil, dstore.ErrNotFound))
+	assert.Equal(t, blockLookupWrongID, blockLookupOutcome(nil, errWrongBlock))
+	assert.Equal(t, blockLookupError, blockLookupOutcome(nil, context.DeadlineExceeded))
+}
+
+func TestStreamFactoryNewRejectsInvalidArguments(t *testing.T) {
+	nonFinalCursor := (&bstream.Cursor{
+		Step:      bstream.StepNew,
+		Block:     bstream.NewBlockRef("00000012b", 12),
+		HeadBlock: bstream.NewBlockRef("00000012b", 12),
+		LIB:       bstream.NewBlockRef("00000010a", 10),
+	}).ToOpaque()
+
+	tests := []struct {
+		name    string
+		request *pbfirehose.Request
+	}{
+		{"start after stop", &pbfirehose.Request{StartBlockNum: 10, StopBlockNum: 5}},
+		{"final blocks only from non-final cursor", &pbfirehose.Request{Cursor: nonFinalCursor, FinalBlocksOnly: true}},
+	}
+
+	sf := NewStreamFactory(dstore.NewMockStore(nil), nil, nil, transform.NewRegistry())
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := sf.New(context.Background(), bstream.HandlerFunc(func(*bstream.Block, interface{}) error { return nil }), test.request, false, zap.NewNop())
+			require.Error(t, err)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+			assert.False(t, IsUnresolvedCursorError(err))
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package firehose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/bstream/stream"
+	"github.com/streamingfast/dstore"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"go.uber.org/zap"
+)
+
+// ForkRecovery resumes a stream from a cursor whose block was forked out and cannot be
+// resolved by the regular stream anymore. The handler first receives the UNDO steps of
+// every forked block between the cursor block and its last common ancestor with the
+// canonical chain, then the canonical chain from that ancestor onwards.
+type ForkRecovery struct {
+	handler     bstream.Handler
+	preprocFunc bstream.PreprocessFunc
+
+	lib        bstream.BlockRef
+	undoBlocks []*bstream.Block // highest first
+	ancestor   bstream.BlockRef
+	next       *stream.Stream
+
+	logger *zap.Logger
+}
+
+// NewForkRecovery walks back from the block of the request cursor to the canonical chain
+// using the hub, the forked blocks store and the merged blocks store. When no path can be
+// found, the returned ErrCursorOnUnknownFork holds the last block known to be safe.
+func (sf *StreamFactory) NewForkRecovery(
+	ctx context.Context,
+	handler bstream.Handler,
+	request *pbfirehose.Request,
+	decodeBlock bool,
+	logger *zap.Logger) (*ForkRecovery, error) {
+
+	cursor, err := sf.DecodeCursor(request.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	undoBlocks, ancestor, err := sf.walkToCanonical(ctx, cursor)
+	if err != nil {
+		var errStoreUnavailable *ErrStoreUnavailable
+		if errors.As(err, &errStoreUnavailable) {
+			return nil, err
+		}
+		return nil, sf.newErrCursorOnUnknownFork(cursor, err)
+	}
+
+	var preprocFunc bstream.PreprocessFunc
+	if sf.transformRegistry != nil {
+		preprocFunc, _, _, err = sf.transformRegistry.BuildFromTransforms(request.Transforms)
+		if err != nil {
+			return nil, NewErrTransformRejected(err)
+		}
+	}
+	if preprocFunc == nil && decodeBlock {
+		preprocFunc = bstreamToProtocolPreprocFunc
+	}
+
+	next, err := sf.New(ctx, handler, &pbfirehose.Request{
+		StartBlockNum:   int64(ancestor.Num() + 1),
+		StopBlockNum:    request.StopBlockNum,
+		FinalBlocksOnly: request.FinalBlocksOnly,
+		Transforms:      request.Transforms,
+	}, decodeBlock, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ForkRecovery{
+		handler:     handler,
+		preprocFunc: preprocFunc,
+		lib:         cursor.LIB,
+		undoBlocks:  undoBlocks,
+		ancestor:    ancestor,
+		next:        next,
+		logger:      logger,
+	}, nil
+}
+
+func (r *ForkRecovery) Run(ctx context.Context) error {
+	r.logger.Info("recovering cursor from forked out block", zap.Int("undo_count", len(r.undoBlocks)), zap.Stringer("common_ancestor", r.ancestor))
+
+	for _, blk := range r.undoBlocks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var obj interface{}
+		if r.preprocFunc != nil {
+			var err error
+			obj, err = r.preprocFunc(blk)
+			if err != nil {
+				return fmt.Errorf("preprocessing block %s: %w", blk, err)
+			}
+		}
+
+		ref := blk.AsRef()
+		if err := r.handler.ProcessBlock(blk, &cursorObject{
+			cursor: &bstream.Cursor{
+				Step:      bstream.StepUndo,
+				Block:     ref,
+				HeadBlock: ref,
+				LIB:       r.lib,
+			},
+			obj: obj,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return r.next.Run(ctx)
+}
+
+func (sf *StreamFactory) newErrCursorOnUnknownFork(cursor *bstream.Cursor, inner error) *ErrCursorOnUnknownFork {
+	out := NewErrCursorOnUnknownFork(cursor.Block, inner)
+	if cursor.LIB != nil && cursor.LIB.ID() != "" {
+		out.LastSafeBlock = cursor.LIB
+		out.SafeCursor = sf.SignCursor(&bstream.Cursor{
+			Step:      bstream.StepIrreversible,
+			Block:     cursor.LIB,
+			HeadBlock: cursor.LIB,
+			LIB:       cursor.LIB,
+		})
+	}
+	return out
+}
+
+// walkToCanonical returns the blocks to undo, highest first, to go from the cursor block
+// back to its last common ancestor with the canonical chain. The cursor LIB being final,
+// the walk never goes below it.
+func (sf *StreamFactory) walkToCanonical(ctx context.Context, cursor *bstream.Cursor) (undoBlocks []*bstream.Block, ancestor bstream.BlockRef, err error) {
+	lib := cursor.LIB
+	if lib == nil || lib.ID() == "" {
+		return nil, nil, fmt.Errorf("cursor has no final block to walk back to")
+	}
+
+	canonical, err := sf.canonicalBlocksBetween(ctx, lib, cursor.Block.Num())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	forkedBlocksStore, err := requestStore(ctx, sf.forkedBlocksStore, BlockSourceForkedBlocks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	forkedBlocks, err := forkedBlocksBetween(ctx, forkedBlocksStore, lib.Num(), cursor.Block.Num())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	id, maxNum := cursor.Block.ID(), cursor.Block.Num()
+	for first := true; ; first = false {
+		if ref, found := canonical[bstream.TruncateBlockID(id)]; found {
+			return undoBlocks, ref, nil
+		}
+
+		blk, err := sf.forkedBlock(ctx, forkedBlocksStore, forkedBlocks, id, maxNum, lib.Num())
+		if err != nil {
+			return nil, nil, err
+		}
+		if blk == nil {
+			return nil, nil, fmt.Errorf("missing link: block with ID %s not found in the hub nor in the forked blocks store", id)
+		}
+		if blk.Number <= lib.Num() {
+			return nil, nil, fmt.Errorf("block %s not linkable to canonical chain above final block %s", blk.AsRef(), lib)
+		}
+
+		if !(first && cursor.Step.Matches(bstream.StepUndo)) {
+			// an undo cursor means its block was already undone by the client
+			undoBlocks = append(undoBlocks, blk)
+		}
+		id, maxNum = blk.PreviousId, blk.Number-1
+	}
+}
+
+// canonicalBlocksBetween returns the canonical blocks from `lib` up to `upToNum`, keyed
+// by truncated ID, as known by the hub and the merged blocks store.
+func (sf *StreamFactory) canonicalBlocksBetween(ctx context.Context, lib bstream.BlockRef, upToNum uint64) (map[string]bstream.BlockRef, error) {
+	out := map[string]bstream.BlockRef{
+		bstream.TruncateBlockID(lib.ID()): lib,
+	}
+
+	hubLowest := uint64(0)
+	if sf.hub != nil && sf.hub.IsReady() {
+		hubLowest = sf.hub.LowestBlockNum()
+		for num := upToNum; num > hubLowest && num > lib.Num(); num-- {
+			if blk := sf.hub.GetBlock(num, ""); blk != nil {
+				out[bstream.TruncateBlockID(blk.Id)] = blk.AsRef()
+			}
+		}
+	}
+
+	if hubLowest != 0 && hubLowest <= lib.Num() {
+		return out, nil
+	}
+
+	mergedBlocksStore, err := requestStore(ctx, sf.mergedBlocksStore, BlockSourceMergedBlocks)
+	if err != nil {
+		return nil, err
+	}
+
+	for base := lowBoundary(lib.Num(), mergedBlocksBundleSize); base <= upToNum; base += mergedBlocksBundleSize {
+		if hubLowest != 0 && base > hubLowest {
+			break
+		}
+
+		err := readMergedBlocks(ctx, mergedBlocksStore, base, func(blk *bstream.Block) error {
+			if blk.Number >= lib.Num() && blk.Number <= upToNum {
+				out[bstream.TruncateBlockID(blk.Id)] = blk.AsRef()
+			}
+			return nil
+		})
+		if err != nil {
+			var errRangeNotAvailable *ErrRangeNotAvailable
+			if errors.As(err, &errRangeNotAvailable) {
+				break
+			}
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// forkedBlocksBetween lists the forked blocks files from `fromNum` up to `upToNum`,
+// keyed by truncated ID. The store can be nil.
+func forkedBlocksBetween(ctx context.Context, forkedBlocksStore dstore.Store, fromNum, upToNum uint64) (map[string]*bstream.OneBlockFile, error) {
+	out := make(map[string]*bstream.OneBlockFile)
+	if forkedBlocksStore == nil {
+		return out, nil
+	}
+
+	err := forkedBlocksStore.WalkFrom(ctx, "", fmt.Sprintf("%010d", fromNum), func(filename string) error {
+		obf, err := bstream.NewOneBlockFile(filename)
+		if err != nil {
+			return nil
+		}
+		if obf.Num > upToNum {
+			return dstore.StopIteration
+		}
+		out[obf.ID] = obf
+		return nil
+	})
+	if err != nil && !errors.Is(err, dstore.StopIteration) {
+		return nil, NewErrStoreUnavailable("forked blocks", err)
+	}
+	return out, nil
+}
+
+// forkedBlock looks for the block `id`, numbered at most `maxNum`, in the hub and in
+// the forked blocks store. It returns nil when not found.
+func (sf *StreamFactory) forkedBlock(ctx context.Context, forkedBlocksStore dstore.Store, forkedBlocks map[string]*bstream.OneBlockFile, id string, maxNum, libNum uint64) (*bstream.Block, error) {
+	if sf.hub != nil && sf.hub.IsReady() {
+		for num := maxNum; num > libNum && num > sf.hub.LowestBlockNum(); num-- {
+			if blk := sf.hub.GetBlock(num, id); blk != nil {
+				return blk, nil
+			}
+		}
+	}
+
+	obf, found := forkedBlocks[bstream.TruncateBlockID(id)]
+	if !found {
+		return nil, nil
+	}
+
+	blk, err := bstream.FetchBlockFromOneBlockStore(ctx, obf.Num, obf.ID, forkedBlocksStore)
+	if err != nil {
+		if errors.Is(err, dstore.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, NewErrStoreUnavailable("forked blocks", err)
+	}
+	return blk, nil
+}
@@ -0,0 +1,91 @@
+package firehose
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalkToCanonical(t *testing.T) {
+	mergedStore := dstore.NewMockStore(nil)
+	mergedStore.SetFile("0000000000", []byte(strings.Join([]string{
+		bstream.TestJSONBlockWithLIBNum("00000002a", "00000001a", 1),
+		bstream.TestJSONBlockWithLIBNum("00000003a", "00000002a", 2),
+		bstream.TestJSONBlockWithLIBNum("00000004a", "00000003a", 3),
+		bstream.TestJSONBlockWithLIBNum("00000005a", "00000004a", 4),
+	}, "\n")))
+
+	forkedStore := dstore.NewMockStore(nil)
+	forkedStore.SetFile("0000000004-00000004b-00000003a-2-mindreader", []byte(bstream.TestJSONBlockWithLIBNum("00000004b", "00000003a", 2)))
+	forkedStore.SetFile("0000000005-00000005b-00000004b-2-mindreader", []byte(bstream.TestJSONBlockWithLIBNum("00000005b", "00000004b", 2)))
+	forkedStore.SetFile("0000000006-00000006c-00000005c-2-mindreader", []byte(bstream.TestJSONBlockWithLIBNum("00000006c", "00000005c", 2)))
+
+	sf := NewStreamFactory(mergedStore, forkedStore, nil, nil)
+	lib := bstream.NewBlockRef("00000002a", 2)
+
+	tests := []struct {
+		name             string
+		cursor           *bstream.Cursor
+		expectedUndo     []string
+		expectedAncestor string
+		expectError      bool
+	}{
+		{
+			"forked cursor",
+			&bstream.Cursor{Step: bstream.StepNew, Block: bstream.NewBlockRef("00000005b", 5), HeadBlock: bstream.NewBlockRef("00000005b", 5), LIB: lib},
+			[]string{"00000005b", "00000004b"},
+			"00000003a",
+			false,
+		},
+		{
+			"forked undo cursor",
+			&bstream.Cursor{Step: bstream.StepUndo, Block: bstream.NewBlockRef("00000005b", 5), HeadBlock: bstream.NewBlockRef("00000005b", 5), LIB: lib},
+			[]string{"00000004b"},
+			"00000003a",
+			false,
+		},
+		{
+			"missing link",
+			&bstream.Cursor{Step: bstream.StepNew, Block: bstream.NewBlockRef("00000006c", 6), HeadBlock: bstream.NewBlockRef("00000006c", 6), LIB: lib},
+			nil,
+			"",
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			undo, ancestor, err := sf.walkToCanonical(context.Background(), test.cursor)
+			if test.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			var undoIDs []string
+			for _, blk := range undo {
+				undoIDs = append(undoIDs, blk.Id)
+			}
+			assert.Equal(t, test.expectedUndo, undoIDs)
+			assert.Equal(t, test.expectedAncestor, ancestor.ID())
+		})
+	}
+}
+
+func TestNewErrCursorOnUnknownForkSafeCursor(t *testing.T) {
+	sf := NewStreamFactory(nil, nil, nil, nil)
+	lib := bstream.NewBlockRef("00000002a", 2)
+
+	err := sf.newErrCursorOnUnknownFork(&bstream.Cursor{Step: bstream.StepNew, Block: bstream.NewBlockRef("00000006c", 6), HeadBlock: bstream.NewBlockRef("00000006c", 6), LIB: lib}, assert.AnError)
+	assert.Equal(t, lib, err.LastSafeBlock)
+
+	safe, decodeErr := sf.DecodeCursor(err.SafeCursor)
+	require.NoError(t, decodeErr)
+	assert.True(t, safe.IsOnFinalBlock())
+	assert.Equal(t, lib.ID(), safe.Block.ID())
+}
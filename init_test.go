@@ -1,6 +1,11 @@
 package firehose
 
 import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
 	"github.com/streamingfast/bstream"
 	"github.com/streamingfast/logging"
 )
@@ -8,5 +13,46 @@ import (
 func init() {
 	logging.InstantiateLoggers()
 
-	bstream.GetBlockReaderFactory = bstream.TestBlockReaderFactory
+	bstream.GetBlockPayloadSetter = bstream.MemoryBlockPayloadSetter
+	bstream.GetBlockReaderFactory = bstream.BlockReaderFactoryFunc(func(reader io.Reader) (bstream.BlockReader, error) {
+		return &testBlockReader{scanner: bufio.NewScanner(reader)}, nil
+	})
+}
+
+// testBlockReader reads the blocks of bstream.TestJSONBlockWithLIBNum like
+// bstream.TestBlockReaderFactory, without assigning bstream.GetBlockPayloadSetter on
+// every block, which races when several sources read blocks concurrently.
+type testBlockReader struct {
+	scanner *bufio.Scanner
+}
+
+func (r *testBlockReader) Read() (*bstream.Block, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	content := r.scanner.Text()
+	obj := &bstream.ParsableTestBlock{}
+	if err := json.Unmarshal([]byte(content), obj); err != nil {
+		return nil, fmt.Errorf("unable to read block %q: %w", content, err)
+	}
+
+	number := obj.Number
+	if number == 0 {
+		id := obj.ID
+		if len(id) < 8 { // shorter version, like 8a for 00000008a
+			id = fmt.Sprintf("%09s", id)
+		}
+		fmt.Sscanf(id[:8], "%x", &number)
+	}
+
+	return bstream.MemoryBlockPayloadSetter(&bstream.Block{
+		Id:         obj.ID,
+		Number:     number,
+		PreviousId: obj.PreviousID,
+		LibNum:     obj.LIBNum,
+	}, []byte(content))
 }
@@ -0,0 +1,19 @@
+// Package admin holds what the HTTP handlers served to operators on the admin listener
+// share.
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// WriteJSON sends `v` encoded as JSON with status `code`
+func WriteJSON(w http.ResponseWriter, code int, v interface{}, logger *zap.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Debug("unable to write admin response", zap.Error(err))
+	}
+}
@@ -9,6 +9,23 @@ var Metricset = dmetrics.NewSet()
 var AppReadiness = Metricset.NewAppReadiness("firehose")
 var ActiveRequests = Metricset.NewGauge("firehose_active_requests", "Number of active requests")
 var RequestCounter = Metricset.NewCounter("firehose_requests_counter", "Request count")
+var SendBufferBytes = Metricset.NewGauge("firehose_send_buffer_bytes", "Number of bytes of responses queued in send buffers across all streams")
+var SlowConsumers = Metricset.NewGauge("firehose_slow_consumers", "Number of active requests currently flagged as slow consumers")
+var DrainingStreams = Metricset.NewGauge("firehose_draining_streams", "Number of in-flight streams left to terminate while the server drains")
+var DrainedStreams = Metricset.NewCounter("firehose_drained_streams_counter", "Number of streams terminated by a server drain")
+
+var StreamDuration = Metricset.NewHistogram("firehose_stream_duration", "Duration of Blocks streams, in seconds")
+var StreamBlocks = Metricset.NewHistogram("firehose_stream_blocks", "Number of blocks sent per Blocks stream")
+var StreamBytes = Metricset.NewHistogram("firehose_stream_bytes", "Number of bytes sent per Blocks stream")
+var StreamSendLatency = Metricset.NewHistogram("firehose_stream_send_latency", "Time spent sending a response to the client, in seconds")
+var StreamTimeToFirstBlock = Metricset.NewHistogram("firehose_stream_time_to_first_block", "Time between receiving a Blocks request and sending its first block, in seconds")
+var StreamTerminations = Metricset.NewCounterVec("firehose_stream_terminations_counter", []string{"code"}, "Number of Blocks streams terminated, by gRPC status code")
+
+var LiveStreamLatency = Metricset.NewHistogram("firehose_live_stream_latency", "Time between the production of a live block and its sending to a stream, in seconds")
+var LiveStreamWorstLag = Metricset.NewGauge("firehose_live_stream_worst_lag", "Lag behind real time of the most late active live stream, in seconds")
+
+var BlockGetterLookups = Metricset.NewCounterVec("firehose_block_getter_lookups_counter", []string{"source", "outcome"}, "Number of single block lookups, by source and outcome (found, not_found, wrong_id, error)")
+var BlockGetterLookupLatency = Metricset.NewHistogramVec("firehose_block_getter_lookup_latency", []string{"source", "outcome"}, "Duration of single block lookups, by source and outcome, in seconds")
 
 var ActiveSubstreams = Metricset.NewGauge("firehose_active_substreams", "Number of active substreams requests")
 var SubstreamsCounter = Metricset.NewCounter("firehose_substreams_counter", "Substreams requests count")
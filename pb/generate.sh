@@ -0,0 +1,27 @@
+#!/bin/bash
+
+ROOT="$( cd "$( dirname "${BASH_SOURCE[0]}" )/.." && pwd )"
+
+# Protobuf definitions
+PROTO=${PROTO:-"$ROOT/proto"}
+
+function main() {
+  current_dir="`pwd`"
+  trap "cd \"$current_dir\"" EXIT
+  pushd "$ROOT/pb" &> /dev/null
+
+  generate "streamingfast/firehose/cursor/v1/cursor_inspector.proto"
+}
+
+# usage:
+# - generate <protoPath>
+function generate() {
+    for file in "$@"; do
+      protoc -I$PROTO \
+        --go_out=. --go_opt=paths=source_relative \
+        --go-grpc_out=. --go-grpc_opt=paths=source_relative,require_unimplemented_servers=false \
+         $file
+    done
+}
+
+main "$@"
@@ -0,0 +1,510 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.30.0
+// 	protoc        (unknown)
+// source: streamingfast/firehose/cursor/v1/cursor_inspector.proto
+
+package pbcursor
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Canonicality int32
+
+const (
+	Canonicality_CANONICALITY_UNKNOWN   Canonicality = 0
+	Canonicality_CANONICALITY_CANONICAL Canonicality = 1
+	Canonicality_CANONICALITY_FORKED    Canonicality = 2
+)
+
+// Enum value maps for Canonicality.
+var (
+	Canonicality_name = map[int32]string{
+		0: "CANONICALITY_UNKNOWN",
+		1: "CANONICALITY_CANONICAL",
+		2: "CANONICALITY_FORKED",
+	}
+	Canonicality_value = map[string]int32{
+		"CANONICALITY_UNKNOWN":   0,
+		"CANONICALITY_CANONICAL": 1,
+		"CANONICALITY_FORKED":    2,
+	}
+)
+
+func (x Canonicality) Enum() *Canonicality {
+	p := new(Canonicality)
+	*p = x
+	return p
+}
+
+func (x Canonicality) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Canonicality) Descriptor() protoreflect.EnumDescriptor {
+	return file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_enumTypes[0].Descriptor()
+}
+
+func (Canonicality) Type() protoreflect.EnumType {
+	return &file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_enumTypes[0]
+}
+
+func (x Canonicality) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Canonicality.Descriptor instead.
+func (Canonicality) EnumDescriptor() ([]byte, []int) {
+	return file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_rawDescGZIP(), []int{0}
+}
+
+type InspectCursorRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Cursor is the opaque cursor, as received from `sf.firehose.v2.Stream/Blocks`.
+	Cursor string `protobuf:"bytes,1,opt,name=cursor,proto3" json:"cursor,omitempty"`
+}
+
+func (x *InspectCursorRequest) Reset() {
+	*x = InspectCursorRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *InspectCursorRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InspectCursorRequest) ProtoMessage() {}
+
+func (x *InspectCursorRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InspectCursorRequest.ProtoReflect.Descriptor instead.
+func (*InspectCursorRequest) Descriptor() ([]byte, []int) {
+	return file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *InspectCursorRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+type BlockRef struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Num uint64 `protobuf:"varint,1,opt,name=num,proto3" json:"num,omitempty"`
+	Id  string `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+}
+
+func (x *BlockRef) Reset() {
+	*x = BlockRef{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BlockRef) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlockRef) ProtoMessage() {}
+
+func (x *BlockRef) ProtoReflect() protoreflect.Message {
+	mi := &file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlockRef.ProtoReflect.Descriptor instead.
+func (*BlockRef) Descriptor() ([]byte, []int) {
+	return file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *BlockRef) GetNum() uint64 {
+	if x != nil {
+		return x.Num
+	}
+	return 0
+}
+
+func (x *BlockRef) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type InspectCursorResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Step is the bstream step of the cursor, a bit field, and StepName its name.
+	Step      uint32       `protobuf:"varint,1,opt,name=step,proto3" json:"step,omitempty"`
+	StepName  string       `protobuf:"bytes,2,opt,name=step_name,json=stepName,proto3" json:"step_name,omitempty"`
+	Block     *BlockRef    `protobuf:"bytes,3,opt,name=block,proto3" json:"block,omitempty"`
+	Lib       *BlockRef    `protobuf:"bytes,4,opt,name=lib,proto3" json:"lib,omitempty"`
+	HeadBlock *BlockRef    `protobuf:"bytes,5,opt,name=head_block,json=headBlock,proto3" json:"head_block,omitempty"`
+	Canonical Canonicality `protobuf:"varint,6,opt,name=canonical,proto3,enum=streamingfast.firehose.cursor.v1.Canonicality" json:"canonical,omitempty"`
+	// Resumable is true when the cursor can be used to resume a stream on this server,
+	// NotResumableReason explains why otherwise.
+	Resumable          bool   `protobuf:"varint,7,opt,name=resumable,proto3" json:"resumable,omitempty"`
+	NotResumableReason string `protobuf:"bytes,8,opt,name=not_resumable_reason,json=notResumableReason,proto3" json:"not_resumable_reason,omitempty"`
+	// ServerHeadNum is the head block number of this server, 0 when unknown, and
+	// BlocksBehindHead the distance between it and the cursor block.
+	ServerHeadNum    uint64 `protobuf:"varint,9,opt,name=server_head_num,json=serverHeadNum,proto3" json:"server_head_num,omitempty"`
+	BlocksBehindHead uint64 `protobuf:"varint,10,opt,name=blocks_behind_head,json=blocksBehindHead,proto3" json:"blocks_behind_head,omitempty"`
+	// MultiRange is true for cursors issued by multi-range requests, Segment being the
+	// index of the range the cursor belongs to. SegmentBoundary is true for the cursors of
+	// segment boundaries, which reference no block and resume at the start of Segment.
+	MultiRange      bool   `protobuf:"varint,11,opt,name=multi_range,json=multiRange,proto3" json:"multi_range,omitempty"`
+	Segment         uint32 `protobuf:"varint,12,opt,name=segment,proto3" json:"segment,omitempty"`
+	SegmentBoundary bool   `protobuf:"varint,13,opt,name=segment_boundary,json=segmentBoundary,proto3" json:"segment_boundary,omitempty"`
+	// Descending is true for cursors issued by descending order requests.
+	Descending bool `protobuf:"varint,14,opt,name=descending,proto3" json:"descending,omitempty"`
+}
+
+func (x *InspectCursorResponse) Reset() {
+	*x = InspectCursorResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *InspectCursorResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InspectCursorResponse) ProtoMessage() {}
+
+func (x *InspectCursorResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InspectCursorResponse.ProtoReflect.Descriptor instead.
+func (*InspectCursorResponse) Descriptor() ([]byte, []int) {
+	return file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *InspectCursorResponse) GetStep() uint32 {
+	if x != nil {
+		return x.Step
+	}
+	return 0
+}
+
+func (x *InspectCursorResponse) GetStepName() string {
+	if x != nil {
+		return x.StepName
+	}
+	return ""
+}
+
+func (x *InspectCursorResponse) GetBlock() *BlockRef {
+	if x != nil {
+		return x.Block
+	}
+	return nil
+}
+
+func (x *InspectCursorResponse) GetLib() *BlockRef {
+	if x != nil {
+		return x.Lib
+	}
+	return nil
+}
+
+func (x *InspectCursorResponse) GetHeadBlock() *BlockRef {
+	if x != nil {
+		return x.HeadBlock
+	}
+	return nil
+}
+
+func (x *InspectCursorResponse) GetCanonical() Canonicality {
+	if x != nil {
+		return x.Canonical
+	}
+	return Canonicality_CANONICALITY_UNKNOWN
+}
+
+func (x *InspectCursorResponse) GetResumable() bool {
+	if x != nil {
+		return x.Resumable
+	}
+	return false
+}
+
+func (x *InspectCursorResponse) GetNotResumableReason() string {
+	if x != nil {
+		return x.NotResumableReason
+	}
+	return ""
+}
+
+func (x *InspectCursorResponse) GetServerHeadNum() uint64 {
+	if x != nil {
+		return x.ServerHeadNum
+	}
+	return 0
+}
+
+func (x *InspectCursorResponse) GetBlocksBehindHead() uint64 {
+	if x != nil {
+		return x.BlocksBehindHead
+	}
+	return 0
+}
+
+func (x *InspectCursorResponse) GetMultiRange() bool {
+	if x != nil {
+		return x.MultiRange
+	}
+	return false
+}
+
+func (x *InspectCursorResponse) GetSegment() uint32 {
+	if x != nil {
+		return x.Segment
+	}
+	return 0
+}
+
+func (x *InspectCursorResponse) GetSegmentBoundary() bool {
+	if x != nil {
+		return x.SegmentBoundary
+	}
+	return false
+}
+
+func (x *InspectCursorResponse) GetDescending() bool {
+	if x != nil {
+		return x.Descending
+	}
+	return false
+}
+
+var File_streamingfast_firehose_cursor_v1_cursor_inspector_proto protoreflect.FileDescriptor
+
+var file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_rawDesc = []byte{
+	0x0a, 0x37, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x69, 0x6e, 0x67, 0x66, 0x61, 0x73, 0x74, 0x2f,
+	0x66, 0x69, 0x72, 0x65, 0x68, 0x6f, 0x73, 0x65, 0x2f, 0x63, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x2f,
+	0x76, 0x31, 0x2f, 0x63, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x5f, 0x69, 0x6e, 0x73, 0x70, 0x65, 0x63,
+	0x74, 0x6f, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x20, 0x73, 0x74, 0x72, 0x65, 0x61,
+	0x6d, 0x69, 0x6e, 0x67, 0x66, 0x61, 0x73, 0x74, 0x2e, 0x66, 0x69, 0x72, 0x65, 0x68, 0x6f, 0x73,
+	0x65, 0x2e, 0x63, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x2e, 0x76, 0x31, 0x22, 0x2e, 0x0a, 0x14, 0x49,
+	0x6e, 0x73, 0x70, 0x65, 0x63, 0x74, 0x43, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x06, 0x63, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x22, 0x2c, 0x0a, 0x08, 0x42,
+	0x6c, 0x6f, 0x63, 0x6b, 0x52, 0x65, 0x66, 0x12, 0x10, 0x0a, 0x03, 0x6e, 0x75, 0x6d, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x04, 0x52, 0x03, 0x6e, 0x75, 0x6d, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x22, 0x8d, 0x05, 0x0a, 0x15, 0x49, 0x6e,
+	0x73, 0x70, 0x65, 0x63, 0x74, 0x43, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x74, 0x65, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x04, 0x73, 0x74, 0x65, 0x70, 0x12, 0x1b, 0x0a, 0x09, 0x73, 0x74, 0x65, 0x70, 0x5f,
+	0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x73, 0x74, 0x65, 0x70,
+	0x4e, 0x61, 0x6d, 0x65, 0x12, 0x40, 0x0a, 0x05, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x2a, 0x2e, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x69, 0x6e, 0x67, 0x66,
+	0x61, 0x73, 0x74, 0x2e, 0x66, 0x69, 0x72, 0x65, 0x68, 0x6f, 0x73, 0x65, 0x2e, 0x63, 0x75, 0x72,
+	0x73, 0x6f, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x52, 0x65, 0x66, 0x52,
+	0x05, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x12, 0x3c, 0x0a, 0x03, 0x6c, 0x69, 0x62, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x2a, 0x2e, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x69, 0x6e, 0x67, 0x66,
+	0x61, 0x73, 0x74, 0x2e, 0x66, 0x69, 0x72, 0x65, 0x68, 0x6f, 0x73, 0x65, 0x2e, 0x63, 0x75, 0x72,
+	0x73, 0x6f, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x52, 0x65, 0x66, 0x52,
+	0x03, 0x6c, 0x69, 0x62, 0x12, 0x49, 0x0a, 0x0a, 0x68, 0x65, 0x61, 0x64, 0x5f, 0x62, 0x6c, 0x6f,
+	0x63, 0x6b, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x2a, 0x2e, 0x73, 0x74, 0x72, 0x65, 0x61,
+	0x6d, 0x69, 0x6e, 0x67, 0x66, 0x61, 0x73, 0x74, 0x2e, 0x66, 0x69, 0x72, 0x65, 0x68, 0x6f, 0x73,
+	0x65, 0x2e, 0x63, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x42, 0x6c, 0x6f, 0x63,
+	0x6b, 0x52, 0x65, 0x66, 0x52, 0x09, 0x68, 0x65, 0x61, 0x64, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x12,
+	0x4c, 0x0a, 0x09, 0x63, 0x61, 0x6e, 0x6f, 0x6e, 0x69, 0x63, 0x61, 0x6c, 0x18, 0x06, 0x20, 0x01,
+	0x28, 0x0e, 0x32, 0x2e, 0x2e, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x69, 0x6e, 0x67, 0x66, 0x61,
+	0x73, 0x74, 0x2e, 0x66, 0x69, 0x72, 0x65, 0x68, 0x6f, 0x73, 0x65, 0x2e, 0x63, 0x75, 0x72, 0x73,
+	0x6f, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x61, 0x6e, 0x6f, 0x6e, 0x69, 0x63, 0x61, 0x6c, 0x69,
+	0x74, 0x79, 0x52, 0x09, 0x63, 0x61, 0x6e, 0x6f, 0x6e, 0x69, 0x63, 0x61, 0x6c, 0x12, 0x1c, 0x0a,
+	0x09, 0x72, 0x65, 0x73, 0x75, 0x6d, 0x61, 0x62, 0x6c, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x09, 0x72, 0x65, 0x73, 0x75, 0x6d, 0x61, 0x62, 0x6c, 0x65, 0x12, 0x30, 0x0a, 0x14, 0x6e,
+	0x6f, 0x74, 0x5f, 0x72, 0x65, 0x73, 0x75, 0x6d, 0x61, 0x62, 0x6c, 0x65, 0x5f, 0x72, 0x65, 0x61,
+	0x73, 0x6f, 0x6e, 0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x12, 0x6e, 0x6f, 0x74, 0x52, 0x65,
+	0x73, 0x75, 0x6d, 0x61, 0x62, 0x6c, 0x65, 0x52, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x12, 0x26, 0x0a,
+	0x0f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x5f, 0x68, 0x65, 0x61, 0x64, 0x5f, 0x6e, 0x75, 0x6d,
+	0x18, 0x09, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0d, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x48, 0x65,
+	0x61, 0x64, 0x4e, 0x75, 0x6d, 0x12, 0x2c, 0x0a, 0x12, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x73, 0x5f,
+	0x62, 0x65, 0x68, 0x69, 0x6e, 0x64, 0x5f, 0x68, 0x65, 0x61, 0x64, 0x18, 0x0a, 0x20, 0x01, 0x28,
+	0x04, 0x52, 0x10, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x73, 0x42, 0x65, 0x68, 0x69, 0x6e, 0x64, 0x48,
+	0x65, 0x61, 0x64, 0x12, 0x1f, 0x0a, 0x0b, 0x6d, 0x75, 0x6c, 0x74, 0x69, 0x5f, 0x72, 0x61, 0x6e,
+	0x67, 0x65, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x6d, 0x75, 0x6c, 0x74, 0x69, 0x52,
+	0x61, 0x6e, 0x67, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x18,
+	0x0c, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x12, 0x29,
+	0x0a, 0x10, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x5f, 0x62, 0x6f, 0x75, 0x6e, 0x64, 0x61,
+	0x72, 0x79, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0f, 0x73, 0x65, 0x67, 0x6d, 0x65, 0x6e,
+	0x74, 0x42, 0x6f, 0x75, 0x6e, 0x64, 0x61, 0x72, 0x79, 0x12, 0x1e, 0x0a, 0x0a, 0x64, 0x65, 0x73,
+	0x63, 0x65, 0x6e, 0x64, 0x69, 0x6e, 0x67, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x64,
+	0x65, 0x73, 0x63, 0x65, 0x6e, 0x64, 0x69, 0x6e, 0x67, 0x2a, 0x5d, 0x0a, 0x0c, 0x43, 0x61, 0x6e,
+	0x6f, 0x6e, 0x69, 0x63, 0x61, 0x6c, 0x69, 0x74, 0x79, 0x12, 0x18, 0x0a, 0x14, 0x43, 0x41, 0x4e,
+	0x4f, 0x4e, 0x49, 0x43, 0x41, 0x4c, 0x49, 0x54, 0x59, 0x5f, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57,
+	0x4e, 0x10, 0x00, 0x12, 0x1a, 0x0a, 0x16, 0x43, 0x41, 0x4e, 0x4f, 0x4e, 0x49, 0x43, 0x41, 0x4c,
+	0x49, 0x54, 0x59, 0x5f, 0x43, 0x41, 0x4e, 0x4f, 0x4e, 0x49, 0x43, 0x41, 0x4c, 0x10, 0x01, 0x12,
+	0x17, 0x0a, 0x13, 0x43, 0x41, 0x4e, 0x4f, 0x4e, 0x49, 0x43, 0x41, 0x4c, 0x49, 0x54, 0x59, 0x5f,
+	0x46, 0x4f, 0x52, 0x4b, 0x45, 0x44, 0x10, 0x02, 0x32, 0x94, 0x01, 0x0a, 0x0f, 0x43, 0x75, 0x72,
+	0x73, 0x6f, 0x72, 0x49, 0x6e, 0x73, 0x70, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x12, 0x80, 0x01, 0x0a,
+	0x0d, 0x49, 0x6e, 0x73, 0x70, 0x65, 0x63, 0x74, 0x43, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x12, 0x36,
+	0x2e, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x69, 0x6e, 0x67, 0x66, 0x61, 0x73, 0x74, 0x2e, 0x66,
+	0x69, 0x72, 0x65, 0x68, 0x6f, 0x73, 0x65, 0x2e, 0x63, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x2e, 0x76,
+	0x31, 0x2e, 0x49, 0x6e, 0x73, 0x70, 0x65, 0x63, 0x74, 0x43, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x37, 0x2e, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x69,
+	0x6e, 0x67, 0x66, 0x61, 0x73, 0x74, 0x2e, 0x66, 0x69, 0x72, 0x65, 0x68, 0x6f, 0x73, 0x65, 0x2e,
+	0x63, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x49, 0x6e, 0x73, 0x70, 0x65, 0x63,
+	0x74, 0x43, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42,
+	0x50, 0x5a, 0x4e, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x73, 0x74,
+	0x72, 0x65, 0x61, 0x6d, 0x69, 0x6e, 0x67, 0x66, 0x61, 0x73, 0x74, 0x2f, 0x66, 0x69, 0x72, 0x65,
+	0x68, 0x6f, 0x73, 0x65, 0x2f, 0x70, 0x62, 0x2f, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x69, 0x6e,
+	0x67, 0x66, 0x61, 0x73, 0x74, 0x2f, 0x66, 0x69, 0x72, 0x65, 0x68, 0x6f, 0x73, 0x65, 0x2f, 0x63,
+	0x75, 0x72, 0x73, 0x6f, 0x72, 0x2f, 0x76, 0x31, 0x3b, 0x70, 0x62, 0x63, 0x75, 0x72, 0x73, 0x6f,
+	0x72, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_rawDescOnce sync.Once
+	file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_rawDescData = file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_rawDesc
+)
+
+func file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_rawDescGZIP() []byte {
+	file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_rawDescOnce.Do(func() {
+		file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_rawDescData = protoimpl.X.CompressGZIP(file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_rawDescData)
+	})
+	return file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_rawDescData
+}
+
+var file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_goTypes = []interface{}{
+	(Canonicality)(0),             // 0: streamingfast.firehose.cursor.v1.Canonicality
+	(*InspectCursorRequest)(nil),  // 1: streamingfast.firehose.cursor.v1.InspectCursorRequest
+	(*BlockRef)(nil),              // 2: streamingfast.firehose.cursor.v1.BlockRef
+	(*InspectCursorResponse)(nil), // 3: streamingfast.firehose.cursor.v1.InspectCursorResponse
+}
+var file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_depIdxs = []int32{
+	2, // 0: streamingfast.firehose.cursor.v1.InspectCursorResponse.block:type_name -> streamingfast.firehose.cursor.v1.BlockRef
+	2, // 1: streamingfast.firehose.cursor.v1.InspectCursorResponse.lib:type_name -> streamingfast.firehose.cursor.v1.BlockRef
+	2, // 2: streamingfast.firehose.cursor.v1.InspectCursorResponse.head_block:type_name -> streamingfast.firehose.cursor.v1.BlockRef
+	0, // 3: streamingfast.firehose.cursor.v1.InspectCursorResponse.canonical:type_name -> streamingfast.firehose.cursor.v1.Canonicality
+	1, // 4: streamingfast.firehose.cursor.v1.CursorInspector.InspectCursor:input_type -> streamingfast.firehose.cursor.v1.InspectCursorRequest
+	3, // 5: streamingfast.firehose.cursor.v1.CursorInspector.InspectCursor:output_type -> streamingfast.firehose.cursor.v1.InspectCursorResponse
+	5, // [5:6] is the sub-list for method output_type
+	4, // [4:5] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_init() }
+func file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_init() {
+	if File_streamingfast_firehose_cursor_v1_cursor_inspector_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*InspectCursorRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BlockRef); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*InspectCursorResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_goTypes,
+		DependencyIndexes: file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_depIdxs,
+		EnumInfos:         file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_enumTypes,
+		MessageInfos:      file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_msgTypes,
+	}.Build()
+	File_streamingfast_firehose_cursor_v1_cursor_inspector_proto = out.File
+	file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_rawDesc = nil
+	file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_goTypes = nil
+	file_streamingfast_firehose_cursor_v1_cursor_inspector_proto_depIdxs = nil
+}
@@ -0,0 +1,113 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: streamingfast/firehose/cursor/v1/cursor_inspector.proto
+
+package pbcursor
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	CursorInspector_InspectCursor_FullMethodName = "/streamingfast.firehose.cursor.v1.CursorInspector/InspectCursor"
+)
+
+// CursorInspectorClient is the client API for CursorInspector service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CursorInspectorClient interface {
+	// InspectCursor returns the step, block, LIB and head block references of a cursor,
+	// whether its block is still canonical, whether it can be resumed on this server and
+	// how far behind head it is.
+	InspectCursor(ctx context.Context, in *InspectCursorRequest, opts ...grpc.CallOption) (*InspectCursorResponse, error)
+}
+
+type cursorInspectorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCursorInspectorClient(cc grpc.ClientConnInterface) CursorInspectorClient {
+	return &cursorInspectorClient{cc}
+}
+
+func (c *cursorInspectorClient) InspectCursor(ctx context.Context, in *InspectCursorRequest, opts ...grpc.CallOption) (*InspectCursorResponse, error) {
+	out := new(InspectCursorResponse)
+	err := c.cc.Invoke(ctx, CursorInspector_InspectCursor_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CursorInspectorServer is the server API for CursorInspector service.
+// All implementations should embed UnimplementedCursorInspectorServer
+// for forward compatibility
+type CursorInspectorServer interface {
+	// InspectCursor returns the step, block, LIB and head block references of a cursor,
+	// whether its block is still canonical, whether it can be resumed on this server and
+	// how far behind head it is.
+	InspectCursor(context.Context, *InspectCursorRequest) (*InspectCursorResponse, error)
+}
+
+// UnimplementedCursorInspectorServer should be embedded to have forward compatible implementations.
+type UnimplementedCursorInspectorServer struct {
+}
+
+func (UnimplementedCursorInspectorServer) InspectCursor(context.Context, *InspectCursorRequest) (*InspectCursorResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method InspectCursor not implemented")
+}
+
+// UnsafeCursorInspectorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CursorInspectorServer will
+// result in compilation errors.
+type UnsafeCursorInspectorServer interface {
+	mustEmbedUnimplementedCursorInspectorServer()
+}
+
+func RegisterCursorInspectorServer(s grpc.ServiceRegistrar, srv CursorInspectorServer) {
+	s.RegisterService(&CursorInspector_ServiceDesc, srv)
+}
+
+func _CursorInspector_InspectCursor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InspectCursorRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CursorInspectorServer).InspectCursor(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CursorInspector_InspectCursor_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CursorInspectorServer).InspectCursor(ctx, req.(*InspectCursorRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CursorInspector_ServiceDesc is the grpc.ServiceDesc for CursorInspector service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CursorInspector_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "streamingfast.firehose.cursor.v1.CursorInspector",
+	HandlerType: (*CursorInspectorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "InspectCursor",
+			Handler:    _CursorInspector_InspectCursor_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "streamingfast/firehose/cursor/v1/cursor_inspector.proto",
+}
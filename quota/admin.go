@@ -0,0 +1,51 @@
+package quota
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/streamingfast/firehose/internal/admin"
+	"go.uber.org/zap"
+)
+
+// AdminPathPrefix is the path under which NewAdminHandler serves, it must be mounted
+// as-is on the admin mux.
+const AdminPathPrefix = "/quotas/"
+
+// NewAdminHandler serves the usage counters of the current month to operators:
+//
+//	GET    /quotas/           usage of all users
+//	GET    /quotas/<user id>  usage of a user
+//	DELETE /quotas/<user id>  reset the usage of a user
+//
+// It must only be exposed on an administration listener, it is not authenticated.
+func NewAdminHandler(enforcer *Enforcer, logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := strings.TrimPrefix(r.URL.Path, AdminPathPrefix)
+
+		switch {
+		case r.Method == http.MethodGet && userID == "":
+			admin.WriteJSON(w, http.StatusOK, enforcer.List(), logger)
+
+		case r.Method == http.MethodGet:
+			admin.WriteJSON(w, http.StatusOK, enforcer.Usage(userID), logger)
+
+		case r.Method == http.MethodDelete && userID != "":
+			found, err := enforcer.Reset(userID)
+			if err != nil {
+				logger.Warn("unable to persist quota reset", zap.String("user_id", userID), zap.Error(err))
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, "no usage for user", http.StatusNotFound)
+				return
+			}
+			logger.Info("quota usage reset", zap.String("user_id", userID))
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
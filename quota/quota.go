@@ -0,0 +1,188 @@
+package quota
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/dauth"
+	"github.com/streamingfast/firehose"
+	"go.uber.org/zap"
+)
+
+// Names of the quotas, as sent in ErrQuotaExceeded
+const (
+	MonthlyBlocks      = "monthly_blocks"
+	MonthlyEgressBytes = "monthly_egress_bytes"
+)
+
+// Plan holds the quotas of the users subscribed to it, zero values mean unlimited.
+// Quotas are reset at the start of each calendar month, in UTC.
+type Plan struct {
+	MonthlyBlocks      uint64
+	MonthlyEgressBytes uint64
+}
+
+type Config struct {
+	// StorePath is the bbolt database file where the usage counters are persisted
+	StorePath string
+
+	// PlanHeader is the trusted authentication header holding the plan of the caller.
+	// Callers without a plan, or with a plan not listed in Plans, get the Default plan.
+	PlanHeader string
+	Plans      map[string]Plan
+	Default    Plan
+
+	// CheckInterval is how often running streams account their usage and check their
+	// quotas, 10s when zero.
+	CheckInterval time.Duration
+
+	// FlushInterval is how often the counters are persisted, 30s when zero. The usage
+	// accounted since the last flush is lost if the process crashes.
+	FlushInterval time.Duration
+}
+
+// Enforcer accounts the usage of authenticated users and checks it against the
+// quotas of their plan. Requests without a user ID are not subject to quotas.
+type Enforcer struct {
+	config Config
+	store  *Store
+	logger *zap.Logger
+	now    func() time.Time
+
+	closeOnce sync.Once
+	done      chan struct{}
+	flushed   chan struct{}
+}
+
+func New(config Config, logger *zap.Logger) (*Enforcer, error) {
+	if config.StorePath == "" {
+		return nil, fmt.Errorf("a quota store path is required")
+	}
+	if config.CheckInterval == 0 {
+		config.CheckInterval = 10 * time.Second
+	}
+	if config.FlushInterval == 0 {
+		config.FlushInterval = 30 * time.Second
+	}
+
+	store, err := NewStore(config.StorePath)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Enforcer{
+		config:  config,
+		store:   store,
+		logger:  logger,
+		now:     time.Now,
+		done:    make(chan struct{}),
+		flushed: make(chan struct{}),
+	}
+	go e.run()
+
+	return e, nil
+}
+
+func (e *Enforcer) CheckInterval() time.Duration {
+	return e.config.CheckInterval
+}
+
+// Check returns an ErrQuotaExceeded if the caller already used one of its quotas
+func (e *Enforcer) Check(auth dauth.TrustedHeaders) error {
+	userID := auth.UserID()
+	if userID == "" {
+		return nil
+	}
+	return exceeded(e.plan(auth), e.store.Get(userID, e.period()))
+}
+
+// Account adds what was sent to the caller to its usage and returns an ErrQuotaExceeded
+// if it used one of its quotas.
+func (e *Enforcer) Account(auth dauth.TrustedHeaders, blocks, egressBytes uint64) error {
+	userID := auth.UserID()
+	if userID == "" {
+		return nil
+	}
+	return exceeded(e.plan(auth), e.store.Add(userID, e.period(), blocks, egressBytes))
+}
+
+// Usage returns the usage of a user for the current month
+func (e *Enforcer) Usage(userID string) Usage {
+	return e.store.Get(userID, e.period())
+}
+
+// List returns the usage of all users for the current month
+func (e *Enforcer) List() []Usage {
+	return e.store.List(e.period())
+}
+
+// Reset clears the usage of a user for the current month and persists it right away
+func (e *Enforcer) Reset(userID string) (bool, error) {
+	if !e.store.Reset(userID, e.period()) {
+		return false, nil
+	}
+	return true, e.store.Flush()
+}
+
+// Close stops the periodic flush, persists the counters a last time and closes the
+// store
+func (e *Enforcer) Close() (err error) {
+	e.closeOnce.Do(func() {
+		close(e.done)
+		<-e.flushed
+		err = e.store.Flush()
+		if closeErr := e.store.Close(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
+
+func (e *Enforcer) plan(auth dauth.TrustedHeaders) Plan {
+	if e.config.PlanHeader != "" {
+		if plan, found := e.config.Plans[auth.Get(e.config.PlanHeader)]; found {
+			return plan
+		}
+	}
+	return e.config.Default
+}
+
+func (e *Enforcer) period() string {
+	return period(e.now())
+}
+
+func (e *Enforcer) run() {
+	defer close(e.flushed)
+
+	ticker := time.NewTicker(e.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+			now := e.now()
+			// the previous month is kept so it can still be inspected at the start of a month
+			e.store.Prune(period(now), period(now.AddDate(0, 0, -now.UTC().Day())))
+			if err := e.store.Flush(); err != nil {
+				e.logger.Warn("unable to persist quota usage", zap.Error(err))
+			}
+		}
+	}
+}
+
+func period(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+func exceeded(plan Plan, usage Usage) error {
+	if plan.MonthlyBlocks > 0 && usage.Blocks >= plan.MonthlyBlocks {
+		return firehose.NewErrQuotaExceeded(MonthlyBlocks, plan.MonthlyBlocks, usage.Blocks)
+	}
+	if plan.MonthlyEgressBytes > 0 && usage.EgressBytes >= plan.MonthlyEgressBytes {
+		return firehose.NewErrQuotaExceeded(MonthlyEgressBytes, plan.MonthlyEgressBytes, usage.EgressBytes)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package quota
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dauth"
+	"github.com/streamingfast/firehose"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestEnforcer(t *testing.T, path string, now time.Time) *Enforcer {
+	t.Helper()
+
+	e, err := New(Config{
+		StorePath:  path,
+		PlanHeader: "x-sf-plan",
+		Plans:      map[string]Plan{"pro": {MonthlyBlocks: 1000}},
+		Default:    Plan{MonthlyBlocks: 10, MonthlyEgressBytes: 500},
+	}, zap.NewNop())
+	require.NoError(t, err)
+	e.now = func() time.Time { return now }
+	return e
+}
+
+func TestEnforcer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotas.db")
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	e := newTestEnforcer(t, path, now)
+
+	free := dauth.TrustedHeaders{dauth.SFHeaderUserID: "alice"}
+	pro := dauth.TrustedHeaders{dauth.SFHeaderUserID: "bob", "x-sf-plan": "pro"}
+	anonymous := dauth.TrustedHeaders{}
+
+	require.NoError(t, e.Check(free))
+	require.NoError(t, e.Account(free, 9, 100))
+	require.NoError(t, e.Check(free))
+
+	err := e.Account(free, 1, 100)
+	var errQuotaExceeded *firehose.ErrQuotaExceeded
+	require.ErrorAs(t, err, &errQuotaExceeded)
+	assert.Equal(t, MonthlyBlocks, errQuotaExceeded.Quota)
+	assert.Equal(t, uint64(10), errQuotaExceeded.Used)
+	assert.Error(t, e.Check(free))
+
+	require.NoError(t, e.Account(pro, 10, 10_000), "egress is unlimited on the pro plan")
+	require.NoError(t, e.Account(anonymous, 1_000_000, 1_000_000))
+	assert.Equal(t, []Usage{
+		{UserID: "alice", Period: "2026-10", Blocks: 10, EgressBytes: 200},
+		{UserID: "bob", Period: "2026-10", Blocks: 10, EgressBytes: 10_000},
+	}, e.List())
+
+	require.NoError(t, e.Close())
+
+	reopened := newTestEnforcer(t, path, now)
+	defer reopened.Close()
+	assert.Equal(t, Usage{UserID: "alice", Period: "2026-10", Blocks: 10, EgressBytes: 200}, reopened.Usage("alice"))
+	assert.Error(t, reopened.Check(free))
+
+	reopened.now = func() time.Time { return now.AddDate(0, 1, 0) }
+	assert.NoError(t, reopened.Check(free), "quotas are monthly")
+}
+
+func TestStorePrune(t *testing.T) {
+	s, err := NewStore(filepath.Join(t.TempDir(), "quotas.db"))
+	require.NoError(t, err)
+	defer s.Close()
+
+	s.Add("alice", "2026-08", 1, 1)
+	s.Add("alice", "2026-09", 2, 2)
+	s.Add("alice", "2026-10", 3, 3)
+	s.Prune("2026-10", "2026-09")
+
+	assert.Empty(t, s.List("2026-08"))
+	assert.Len(t, s.List("2026-09"), 1)
+	assert.Len(t, s.List("2026-10"), 1)
+}
+
+func TestStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotas.db")
+	s, err := NewStore(path)
+	require.NoError(t, err)
+
+	s.Add("alice", "2026-09", 1, 1)
+	s.Add("alice", "2026-10", 2, 2)
+	s.Add("bob", "2026-10", 3, 3)
+	require.NoError(t, s.Flush())
+
+	s.Reset("alice", "2026-10")
+	s.Prune("2026-10")
+	s.Add("bob", "2026-10", 1, 1)
+	require.NoError(t, s.Flush())
+	require.NoError(t, s.Close())
+
+	reopened, err := NewStore(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	assert.Empty(t, reopened.List("2026-09"))
+	assert.Equal(t, []Usage{{UserID: "bob", Period: "2026-10", Blocks: 4, EgressBytes: 4}}, reopened.List("2026-10"))
+}
+
+func TestAdminHandler(t *testing.T) {
+	e := newTestEnforcer(t, filepath.Join(t.TempDir(), "quotas.db"), time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+	defer e.Close()
+	require.NoError(t, e.Account(dauth.TrustedHeaders{dauth.SFHeaderUserID: "alice"}, 3, 30))
+
+	handler := NewAdminHandler(e, zap.NewNop())
+	do := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/quotas/")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[{"user_id":"alice","period":"2026-10","blocks":3,"egress_bytes":30}]`, rec.Body.String())
+
+	rec = do(http.MethodGet, "/quotas/alice")
+	assert.JSONEq(t, `{"user_id":"alice","period":"2026-10","blocks":3,"egress_bytes":30}`, rec.Body.String())
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/quotas/alice").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/quotas/alice").Code)
+	assert.True(t, strings.Contains(do(http.MethodGet, "/quotas/alice").Body.String(), `"blocks":0`))
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodPost, "/quotas/alice").Code)
+}
@@ -0,0 +1,244 @@
+package quota
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Usage is what a user consumed during a period
+type Usage struct {
+	UserID      string `json:"user_id"`
+	Period      string `json:"period"`
+	Blocks      uint64 `json:"blocks"`
+	EgressBytes uint64 `json:"egress_bytes"`
+}
+
+type counters struct {
+	Blocks      uint64 `json:"blocks"`
+	EgressBytes uint64 `json:"egress_bytes"`
+}
+
+// Store keeps the usage counters in memory and persists them to an embedded bbolt
+// database, one bucket per period keyed by user ID. Each Flush writes the counters
+// changed since the previous one in a single transaction, so its cost grows with the
+// number of active users rather than with the number of known ones. What was added
+// since the last flush is lost if the process crashes.
+type Store struct {
+	db *bolt.DB
+
+	mu      sync.Mutex
+	periods map[string]map[string]*counters // period -> user ID -> counters
+	dirty   map[string]map[string]bool      // period -> user IDs changed since the last flush
+	pruned  map[string]bool                 // periods dropped since the last flush
+}
+
+// NewStore opens the store persisted at `path`, creating it if it does not exist yet.
+// A store can only be opened by one process at a time.
+func NewStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening quota store %q: %w", path, err)
+	}
+
+	s := &Store{
+		db:      db,
+		periods: make(map[string]map[string]*counters),
+		dirty:   make(map[string]map[string]bool),
+		pruned:  make(map[string]bool),
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(period []byte, bucket *bolt.Bucket) error {
+			users := make(map[string]*counters)
+			s.periods[string(period)] = users
+			return bucket.ForEach(func(userID, value []byte) error {
+				c := &counters{}
+				if err := json.Unmarshal(value, c); err != nil {
+					return fmt.Errorf("decoding counters of user %q for period %s: %w", userID, period, err)
+				}
+				users[string(userID)] = c
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("loading quota store %q: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *Store) Add(userID, period string, blocks, egressBytes uint64) Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users, found := s.periods[period]
+	if !found {
+		users = make(map[string]*counters)
+		s.periods[period] = users
+	}
+	c, found := users[userID]
+	if !found {
+		c = &counters{}
+		users[userID] = c
+	}
+
+	c.Blocks += blocks
+	c.EgressBytes += egressBytes
+	s.markDirty(period, userID)
+
+	return Usage{UserID: userID, Period: period, Blocks: c.Blocks, EgressBytes: c.EgressBytes}
+}
+
+func (s *Store) Get(userID, period string) Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := Usage{UserID: userID, Period: period}
+	if c, found := s.periods[period][userID]; found {
+		out.Blocks = c.Blocks
+		out.EgressBytes = c.EgressBytes
+	}
+	return out
+}
+
+// List returns the usage of all the users of a period, sorted by user ID
+func (s *Store) List(period string) []Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]Usage, 0, len(s.periods[period]))
+	for userID, c := range s.periods[period] {
+		out = append(out, Usage{UserID: userID, Period: period, Blocks: c.Blocks, EgressBytes: c.EgressBytes})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].UserID < out[j].UserID })
+	return out
+}
+
+// Reset clears the counters of a user for a period, it returns false if the user had
+// none.
+func (s *Store) Reset(userID, period string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.periods[period][userID]; !found {
+		return false
+	}
+	delete(s.periods[period], userID)
+	s.markDirty(period, userID)
+	return true
+}
+
+// Prune drops the counters of all periods but the ones listed
+func (s *Store) Prune(keep ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := make(map[string]bool, len(keep))
+	for _, period := range keep {
+		kept[period] = true
+	}
+	for period := range s.periods {
+		if !kept[period] {
+			delete(s.periods, period)
+			delete(s.dirty, period)
+			s.pruned[period] = true
+		}
+	}
+}
+
+func (s *Store) markDirty(period, userID string) {
+	users, found := s.dirty[period]
+	if !found {
+		users = make(map[string]bool)
+		s.dirty[period] = users
+	}
+	users[userID] = true
+}
+
+// Flush persists the counters changed since the previous flush
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	if len(s.dirty) == 0 && len(s.pruned) == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+
+	pruned := s.pruned
+	updates := make(map[string]map[string][]byte, len(s.dirty)) // a nil value deletes the counters
+	for period, users := range s.dirty {
+		updates[period] = make(map[string][]byte, len(users))
+		for userID := range users {
+			var value []byte
+			if c, found := s.periods[period][userID]; found {
+				var err error
+				if value, err = json.Marshal(c); err != nil {
+					s.mu.Unlock()
+					return fmt.Errorf("encoding counters of user %q: %w", userID, err)
+				}
+			}
+			updates[period][userID] = value
+		}
+	}
+	dirty := s.dirty
+	s.dirty = make(map[string]map[string]bool)
+	s.pruned = make(map[string]bool)
+	s.mu.Unlock()
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for period := range pruned {
+			if err := tx.DeleteBucket([]byte(period)); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return fmt.Errorf("deleting period %s: %w", period, err)
+			}
+		}
+
+		for period, users := range updates {
+			bucket, err := tx.CreateBucketIfNotExists([]byte(period))
+			if err != nil {
+				return fmt.Errorf("creating period %s: %w", period, err)
+			}
+			for userID, value := range users {
+				if value == nil {
+					err = bucket.Delete([]byte(userID))
+				} else {
+					err = bucket.Put([]byte(userID), value)
+				}
+				if err != nil {
+					return fmt.Errorf("writing counters of user %q for period %s: %w", userID, period, err)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// retried on the next flush, along with what changed in the meantime
+		s.mu.Lock()
+		for period := range pruned {
+			if _, found := s.periods[period]; !found {
+				s.pruned[period] = true
+			}
+		}
+		for period, users := range dirty {
+			if _, found := s.periods[period]; !found {
+				continue
+			}
+			for userID := range users {
+				s.markDirty(period, userID)
+			}
+		}
+		s.mu.Unlock()
+		return fmt.Errorf("persisting quota store: %w", err)
+	}
+	return nil
+}
+
+// Close releases the database, the counters must be flushed before.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,160 @@
+package firehose
+
+import (
+	"context"
+	"sync"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/dmetering"
+	"github.com/streamingfast/dstore"
+)
+
+// BlockSource is where the blocks sent to a client are read from. The one-block files
+// are only read by the hub when it bootstraps, shared by all requests, so blocks served
+// from the hub are attributed to it whatever the hub loaded them from.
+type BlockSource string
+
+const (
+	BlockSourceHub          BlockSource = "hub"
+	BlockSourceMergedBlocks BlockSource = "merged_blocks"
+	BlockSourceForkedBlocks BlockSource = "forked_blocks"
+)
+
+// ReadMeter attributes the bytes read to serve a request to the source of the blocks.
+// Wire bytes are the bytes read from a store, compressed when the store is, or received
+// from the live source for hub blocks. Decompressed bytes are the payload sizes of the
+// blocks read.
+type ReadMeter struct {
+	mu sync.Mutex
+
+	wire         map[BlockSource]uint64
+	decompressed map[BlockSource]uint64
+
+	reportedWire         map[BlockSource]uint64
+	reportedDecompressed map[BlockSource]uint64
+}
+
+type readMeterKeyType int
+
+const readMeterKey readMeterKeyType = iota
+
+// WithReadMeter attaches a ReadMeter to `ctx`, keeping the existing one if any.
+func WithReadMeter(ctx context.Context) context.Context {
+	if GetReadMeter(ctx) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, readMeterKey, &ReadMeter{
+		wire:                 make(map[BlockSource]uint64),
+		decompressed:         make(map[BlockSource]uint64),
+		reportedWire:         make(map[BlockSource]uint64),
+		reportedDecompressed: make(map[BlockSource]uint64),
+	})
+}
+
+// GetReadMeter returns the ReadMeter of `ctx`, nil when there is none. All the methods
+// of a nil ReadMeter are no-ops.
+func GetReadMeter(ctx context.Context) *ReadMeter {
+	m, _ := ctx.Value(readMeterKey).(*ReadMeter)
+	return m
+}
+
+func (m *ReadMeter) AddWire(source BlockSource, n int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.wire[source] += uint64(n)
+}
+
+func (m *ReadMeter) AddDecompressed(source BlockSource, n int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.decompressed[source] += uint64(n)
+}
+
+// Deltas returns the bytes read since the previous call, sources without any
+// bytes read are omitted.
+func (m *ReadMeter) Deltas() (wire, decompressed map[BlockSource]uint64) {
+	if m == nil {
+		return nil, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return sourceBytesDelta(m.wire, m.reportedWire), sourceBytesDelta(m.decompressed, m.reportedDecompressed)
+}
+
+func sourceBytesDelta(current, reported map[BlockSource]uint64) map[BlockSource]uint64 {
+	out := make(map[BlockSource]uint64)
+	for source, n := range current {
+		if delta := n - reported[source]; delta > 0 {
+			out[source] = delta
+		}
+		reported[source] = n
+	}
+	return out
+}
+
+// MeterBlockRead accounts a block read from `source` for the request of `ctx`. Bytes
+// read from stores are accounted by their meter, so only the payload of hub blocks is
+// added to the wire bytes.
+func MeterBlockRead(ctx context.Context, source BlockSource, blk *bstream.Block) error {
+	payload, err := blk.Payload.Get()
+	if err != nil {
+		return err
+	}
+
+	readMeter := GetReadMeter(ctx)
+	readMeter.AddDecompressed(source, len(payload))
+	if source == BlockSourceHub {
+		readMeter.AddWire(source, len(payload))
+		dmetering.GetBytesMeter(ctx).AddBytesRead(len(payload))
+	}
+	return nil
+}
+
+// BlockSource returns where a block sent by a stream was read from: the hub when it
+// covers the block, the forked blocks store for blocks undone below it and the merged
+// blocks store otherwise.
+func (sf *StreamFactory) BlockSource(blk *bstream.Block, step bstream.StepType) BlockSource {
+	if sf.IsLive(blk.Number) {
+		return BlockSourceHub
+	}
+	if step.Matches(bstream.StepUndo) {
+		return BlockSourceForkedBlocks
+	}
+	return BlockSourceMergedBlocks
+}
+
+// IsLive returns true when the block is in the live segment of the chain covered by the hub
+func (sf *StreamFactory) IsLive(num uint64) bool {
+	return sf.hub != nil && sf.hub.IsReady() && num > sf.hub.LowestBlockNum()
+}
+
+// storeMeter counts the bytes read from a store as wire bytes of its source, on top of
+// the request bytes meter.
+type storeMeter struct {
+	source BlockSource
+	read   *ReadMeter
+	bytes  dmetering.Meter
+}
+
+func newStoreMeter(ctx context.Context, source BlockSource) dstore.Meter {
+	return &storeMeter{
+		source: source,
+		read:   GetReadMeter(ctx),
+		bytes:  dmetering.GetBytesMeter(ctx),
+	}
+}
+
+func (m *storeMeter) AddBytesRead(n int) {
+	m.read.AddWire(m.source, n)
+	m.bytes.AddBytesRead(n)
+}
+
+func (m *storeMeter) AddBytesWritten(n int) {
+	m.bytes.AddBytesWritten(n)
+}
@@ -0,0 +1,65 @@
+package firehose
+
+import (
+	"context"
+	"testing"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/dmetering"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadMeter(t *testing.T) {
+	ctx := WithReadMeter(dmetering.WithBytesMeter(context.Background()))
+	readMeter := GetReadMeter(ctx)
+	require.NotNil(t, readMeter)
+	assert.Same(t, readMeter, GetReadMeter(WithReadMeter(ctx)))
+
+	newStoreMeter(ctx, BlockSourceMergedBlocks).AddBytesRead(100)
+	newStoreMeter(ctx, BlockSourceForkedBlocks).AddBytesRead(10)
+
+	blk := bstream.TestBlockWithLIBNum("00000004a", "00000003a", 3)
+	payload, err := blk.Payload.Get()
+	require.NoError(t, err)
+
+	require.NoError(t, MeterBlockRead(ctx, BlockSourceMergedBlocks, blk))
+	require.NoError(t, MeterBlockRead(ctx, BlockSourceHub, blk))
+
+	wire, decompressed := readMeter.Deltas()
+	assert.Equal(t, map[BlockSource]uint64{
+		BlockSourceMergedBlocks: 100,
+		BlockSourceForkedBlocks: 10,
+		BlockSourceHub:          uint64(len(payload)),
+	}, wire)
+	assert.Equal(t, map[BlockSource]uint64{
+		BlockSourceMergedBlocks: uint64(len(payload)),
+		BlockSourceHub:          uint64(len(payload)),
+	}, decompressed)
+	assert.Equal(t, uint64(110+len(payload)), dmetering.GetBytesMeter(ctx).BytesRead(), "store reads and hub payloads are read bytes")
+
+	newStoreMeter(ctx, BlockSourceMergedBlocks).AddBytesRead(5)
+	wire, decompressed = readMeter.Deltas()
+	assert.Equal(t, map[BlockSource]uint64{BlockSourceMergedBlocks: 5}, wire)
+	assert.Empty(t, decompressed)
+}
+
+func TestReadMeterAbsent(t *testing.T) {
+	ctx := context.Background()
+	assert.Nil(t, GetReadMeter(ctx))
+
+	newStoreMeter(ctx, BlockSourceMergedBlocks).AddBytesRead(100)
+	require.NoError(t, MeterBlockRead(ctx, BlockSourceHub, bstream.TestBlock("00000004a", "00000003a")))
+
+	wire, decompressed := GetReadMeter(ctx).Deltas()
+	assert.Nil(t, wire)
+	assert.Nil(t, decompressed)
+}
+
+func TestBlockSource(t *testing.T) {
+	sf := NewStreamFactory(nil, nil, nil, nil)
+	blk := bstream.TestBlock("00000004a", "00000003a")
+
+	assert.Equal(t, BlockSourceMergedBlocks, sf.BlockSource(blk, bstream.StepNewIrreversible))
+	assert.Equal(t, BlockSourceForkedBlocks, sf.BlockSource(blk, bstream.StepUndo))
+}
@@ -0,0 +1,62 @@
+package firehose
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/streamingfast/opaque"
+)
+
+// EncodeSegmentCursor wraps the cursor of a block sent as part of the segment-th range
+// of a multi-range request. Segment boundaries carry an empty cursor, resuming with one
+// starts at the first block of the segment-th range.
+func EncodeSegmentCursor(segment int, cursor string) string {
+	return opaque.EncodeString(fmt.Sprintf("s%d:%s", segment, cursor))
+}
+
+// DecodeSegmentCursor returns the segment and the wrapped cursor of a multi-range cursor
+func DecodeSegmentCursor(in string) (segment int, cursor string, err error) {
+	payload, err := opaque.DecodeToString(in)
+	if err != nil {
+		return 0, "", fmt.Errorf("unable to decode: %w", err)
+	}
+
+	parts := strings.SplitN(payload, ":", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "s") {
+		return 0, "", fmt.Errorf("not a segment cursor")
+	}
+
+	segment, err = strconv.Atoi(strings.TrimPrefix(parts[0], "s"))
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid segment: %w", err)
+	}
+
+	return segment, parts[1], nil
+}
+
+// IsSegmentCursor returns true when `in` was issued by a multi-range request
+func IsSegmentCursor(in string) bool {
+	_, _, err := DecodeSegmentCursor(in)
+	return err == nil
+}
+
+// IsSegmentBoundaryCursor returns true when `in` is the cursor of a multi-range segment
+// boundary, which does not reference a block.
+func IsSegmentBoundaryCursor(in string) bool {
+	_, cursor, err := DecodeSegmentCursor(in)
+	return err == nil && cursor == ""
+}
+
+// unwrapSegmentCursor returns the block cursor wrapped by a multi-range cursor, regular
+// cursors being returned as-is.
+func unwrapSegmentCursor(in string) (string, error) {
+	_, cursor, err := DecodeSegmentCursor(in)
+	if err != nil {
+		return in, nil
+	}
+	if cursor == "" {
+		return "", fmt.Errorf("multi-range segment boundary cursor does not reference a block")
+	}
+	return cursor, nil
+}
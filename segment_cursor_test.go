@@ -0,0 +1,67 @@
+package firehose
+
+import (
+	"testing"
+
+	"github.com/streamingfast/bstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegmentCursorRoundTrip(t *testing.T) {
+	ref := bstream.NewBlockRef("00000012a", 12)
+	blockCursor := (&bstream.Cursor{Step: bstream.StepNew, Block: ref, HeadBlock: ref, LIB: ref}).ToOpaque()
+
+	tests := []struct {
+		name    string
+		segment int
+		cursor  string
+	}{
+		{"block", 1, blockCursor},
+		{"boundary", 3, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded := EncodeSegmentCursor(test.segment, test.cursor)
+			assert.True(t, IsSegmentCursor(encoded))
+
+			segment, cursor, err := DecodeSegmentCursor(encoded)
+			require.NoError(t, err)
+			assert.Equal(t, test.segment, segment)
+			assert.Equal(t, test.cursor, cursor)
+		})
+	}
+
+	assert.False(t, IsSegmentCursor(blockCursor))
+	_, _, err := DecodeSegmentCursor(blockCursor)
+	assert.Error(t, err)
+}
+
+func TestDecodeSegmentCursor(t *testing.T) {
+	ref := bstream.NewBlockRef("00000012a", 12)
+	blockCursor := (&bstream.Cursor{Step: bstream.StepNew, Block: ref, HeadBlock: ref, LIB: ref}).ToOpaque()
+
+	info, err := DecodeCursor(EncodeSegmentCursor(2, blockCursor))
+	require.NoError(t, err)
+	assert.Equal(t, ref, info.Block)
+	assert.True(t, info.MultiRange)
+	assert.Equal(t, 2, info.Segment)
+
+	sf := NewStreamFactory(nil, nil, nil, nil)
+	cursor, err := sf.DecodeCursor(EncodeSegmentCursor(2, blockCursor))
+	require.NoError(t, err)
+	assert.Equal(t, ref, cursor.Block)
+
+	boundary, err := DecodeCursor(EncodeSegmentCursor(2, ""))
+	require.NoError(t, err)
+	assert.True(t, boundary.SegmentBoundary)
+	assert.True(t, boundary.MultiRange)
+	assert.Equal(t, 2, boundary.Segment)
+	assert.Equal(t, uint64(0), boundary.Block.Num())
+
+	// a boundary cursor only resumes a multi-range request, not a stream of blocks
+	var errInvalidCursor *ErrInvalidCursor
+	_, err = sf.DecodeCursor(EncodeSegmentCursor(2, ""))
+	assert.ErrorAs(t, err, &errInvalidCursor)
+}
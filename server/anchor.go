@@ -0,0 +1,11 @@
+package server
+
+// StartAnchorHeader is the request metadata key used by clients to start streaming from
+// a symbolic position resolved by the server instead of a block number: `head`, `lib`,
+// `head-<N>` or `lib-<N>`. When set, the request `StartBlockNum` and `Cursor` must be
+// left empty.
+const StartAnchorHeader = "x-firehose-start-anchor"
+
+// ResolvedStartBlockHeader is the response header metadata key holding the block number
+// a StartAnchorHeader was resolved to.
+const ResolvedStartBlockHeader = "x-firehose-resolved-start-block"
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/bstream/transform"
+	"github.com/streamingfast/dauth"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// AuditEntry records a single `Blocks` or `Block` request once it terminated
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	Endpoint string    `json:"endpoint"`
+
+	UserID   string `json:"user_id,omitempty"`
+	APIKeyID string `json:"api_key_id,omitempty"`
+	IP       string `json:"ip,omitempty"`
+
+	StartBlock      int64  `json:"start_block"`
+	StopBlock       uint64 `json:"stop_block,omitempty"`
+	Cursor          string `json:"cursor,omitempty"`
+	BlockID         string `json:"block_id,omitempty"`
+	Transforms      string `json:"transforms,omitempty"`
+	FinalBlocksOnly bool   `json:"final_blocks_only,omitempty"`
+
+	DurationMs int64  `json:"duration_ms"`
+	BlocksSent uint64 `json:"blocks_sent"`
+	BytesSent  uint64 `json:"bytes_sent"`
+
+	// Status is the gRPC code the request terminated with, Reason the termination
+	// reason also sent in the trailers of `Blocks`.
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// AuditWriter records audit entries, it must be safe for concurrent use
+type AuditWriter interface {
+	Write(entry *AuditEntry) error
+}
+
+type AuditWriterFunc func(entry *AuditEntry) error
+
+func (f AuditWriterFunc) Write(entry *AuditEntry) error {
+	return f(entry)
+}
+
+func WithAuditWriter(writer AuditWriter) Option {
+	return func(s *Server) {
+		s.auditWriter = writer
+	}
+}
+
+// audit completes `entry` with the caller and the outcome of the request then writes it,
+// failures are only logged.
+func (s *Server) audit(ctx context.Context, entry *AuditEntry, start time.Time, err error, logger *zap.Logger) {
+	auth := dauth.FromContext(ctx)
+	entry.Time = start
+	entry.UserID = auth.UserID()
+	entry.APIKeyID = auth.APIKeyID()
+	entry.IP = auth.RealIP()
+	entry.DurationMs = time.Since(start).Milliseconds()
+	entry.Status = status.Code(err).String()
+	entry.Reason = terminationReason(err)
+
+	if writeErr := s.auditWriter.Write(entry); writeErr != nil {
+		logger.Warn("unable to write audit entry", zap.Error(writeErr))
+	}
+}
+
+// transformsDescription describes the transforms of a request with the registry, or
+// by their type when they are unknown to it.
+func transformsDescription(registry *transform.Registry, transforms []*anypb.Any) string {
+	var out []string
+	for _, message := range transforms {
+		if registry != nil {
+			if t, err := registry.New(message); err == nil {
+				out = append(out, t.String())
+				continue
+			}
+		}
+		out = append(out, string(message.MessageName()))
+	}
+	return strings.Join(out, ", ")
+}
+
+// AuditFileWriter writes audit entries as JSON lines to a file, rotated once it reaches
+// its maximum size: `<path>` is renamed to `<path>.1`, `<path>.1` to `<path>.2` and so
+// on, the oldest file beyond the maximum number of rotated files being deleted.
+type AuditFileWriter struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func NewAuditFileWriter(path string, maxBytes int64, maxFiles int) (*AuditFileWriter, error) {
+	w := &AuditFileWriter{
+		path:     path,
+		maxBytes: maxBytes,
+		maxFiles: maxFiles,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *AuditFileWriter) Write(entry *AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encoding audit entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return fmt.Errorf("audit file writer is closed")
+	}
+
+	if w.maxBytes > 0 && w.size > 0 && w.size+int64(len(line)) > w.maxBytes {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("writing audit entry: %w", err)
+	}
+	return nil
+}
+
+func (w *AuditFileWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *AuditFileWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening audit file %q: %w", w.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("reading audit file %q: %w", w.path, err)
+	}
+
+	w.file = file
+	w.size = info.Size()
+	return nil
+}
+
+func (w *AuditFileWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("closing audit file %q: %w", w.path, err)
+	}
+	w.file = nil
+
+	if w.maxFiles > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", w.path, w.maxFiles))
+		for i := w.maxFiles - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+		}
+		if err := os.Rename(w.path, w.path+".1"); err != nil {
+			return fmt.Errorf("rotating audit file %q: %w", w.path, err)
+		}
+	} else if err := os.Remove(w.path); err != nil {
+		return fmt.Errorf("rotating audit file %q: %w", w.path, err)
+	}
+
+	return w.open()
+}
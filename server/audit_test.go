@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/streamingfast/dauth"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAuditFile(t *testing.T, path string) []*AuditEntry {
+	t.Helper()
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var out []*AuditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := &AuditEntry{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), entry))
+		out = append(out, entry)
+	}
+	require.NoError(t, scanner.Err())
+	return out
+}
+
+func TestAuditFileWriterRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	line, err := json.Marshal(&AuditEntry{Endpoint: MeteringEndpointBlocks, UserID: "alice"})
+	require.NoError(t, err)
+
+	w, err := NewAuditFileWriter(path, int64(2*(len(line)+1)), 2)
+	require.NoError(t, err)
+
+	for i := 0; i < 7; i++ {
+		require.NoError(t, w.Write(&AuditEntry{Endpoint: MeteringEndpointBlocks, UserID: "alice"}))
+	}
+	require.NoError(t, w.Close())
+	assert.Error(t, w.Write(&AuditEntry{}))
+
+	assert.Len(t, readAuditFile(t, path), 1)
+	assert.Len(t, readAuditFile(t, path+".1"), 2)
+	assert.Len(t, readAuditFile(t, path+".2"), 2)
+	assert.NoFileExists(t, path+".3")
+}
+
+func TestAuditEntries(t *testing.T) {
+	s, _ := newMeteringTestServer(t)
+
+	var mu sync.Mutex
+	var entries []*AuditEntry
+	s.auditWriter = AuditWriterFunc(func(entry *AuditEntry) error {
+		mu.Lock()
+		defer mu.Unlock()
+		entries = append(entries, entry)
+		return nil
+	})
+
+	ctx := dauth.WithTrustedHeaders(context.Background(), dauth.TrustedHeaders{
+		dauth.SFHeaderUserID:   "alice",
+		dauth.SFHeaderApiKeyID: "key",
+		dauth.SFHeaderIP:       "10.0.0.1",
+	})
+
+	require.NoError(t, s.Blocks(&pbfirehose.Request{StartBlockNum: 2, StopBlockNum: 4, FinalBlocksOnly: true}, testBlocksServer{&testServerStream{ctx: ctx}}))
+	_, err := s.Block(ctx, &pbfirehose.SingleBlockRequest{
+		Reference: &pbfirehose.SingleBlockRequest_BlockNumber_{BlockNumber: &pbfirehose.SingleBlockRequest_BlockNumber{Num: 42}},
+	})
+	require.Error(t, err)
+
+	require.Len(t, entries, 2)
+
+	blocks := entries[0]
+	assert.Equal(t, MeteringEndpointBlocks, blocks.Endpoint)
+	assert.Equal(t, "alice", blocks.UserID)
+	assert.Equal(t, "key", blocks.APIKeyID)
+	assert.Equal(t, "10.0.0.1", blocks.IP)
+	assert.Equal(t, int64(2), blocks.StartBlock)
+	assert.Equal(t, uint64(4), blocks.StopBlock)
+	assert.True(t, blocks.FinalBlocksOnly)
+	assert.Equal(t, uint64(3), blocks.BlocksSent)
+	assert.Greater(t, blocks.BytesSent, uint64(0))
+	assert.Equal(t, "OK", blocks.Status)
+	assert.Equal(t, TerminationCompleted, blocks.Reason)
+
+	block := entries[1]
+	assert.Equal(t, MeteringEndpointBlock, block.Endpoint)
+	assert.Equal(t, int64(42), block.StartBlock)
+	assert.Equal(t, uint64(0), block.BlocksSent)
+	assert.Equal(t, "NotFound", block.Status)
+}
@@ -5,37 +5,55 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
-	"os"
+	"strconv"
 	"time"
 
 	"github.com/streamingfast/dauth"
-	"github.com/streamingfast/dmetering"
 
 	"github.com/streamingfast/bstream"
 	"github.com/streamingfast/bstream/stream"
+	"github.com/streamingfast/firehose"
 	"github.com/streamingfast/firehose/metrics"
 	"github.com/streamingfast/logging"
 	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
 	"go.uber.org/zap"
 
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/anypb"
 )
 
-func (s *Server) Block(ctx context.Context, request *pbfirehose.SingleBlockRequest) (*pbfirehose.SingleBlockResponse, error) {
+func (s *Server) Block(ctx context.Context, request *pbfirehose.SingleBlockRequest) (resp *pbfirehose.SingleBlockResponse, err error) {
 	var blockNum uint64
 	var blockHash string
+
+	if s.auditWriter != nil {
+		start := time.Now()
+		defer func() {
+			entry := &AuditEntry{
+				Endpoint:   MeteringEndpointBlock,
+				StartBlock: int64(blockNum),
+				BlockID:    blockHash,
+				Cursor:     request.GetCursor().GetCursor(),
+			}
+			if resp != nil {
+				entry.BlocksSent = 1
+				entry.BytesSent = uint64(proto.Size(resp))
+			}
+			s.audit(ctx, entry, start, err, s.logger)
+		}()
+	}
+
 	switch ref := request.Reference.(type) {
 	case *pbfirehose.SingleBlockRequest_BlockHashAndNumber_:
 		blockNum = ref.BlockHashAndNumber.Num
 		blockHash = ref.BlockHashAndNumber.Hash
 	case *pbfirehose.SingleBlockRequest_Cursor_:
-		cur, err := bstream.CursorFromOpaque(ref.Cursor.Cursor)
+		cur, err := s.streamFactory.DecodeCursor(ref.Cursor.Cursor)
 		if err != nil {
-			return nil, status.Error(codes.InvalidArgument, err.Error())
+			return nil, err
 		}
 		blockNum = cur.Block.Num()
 		blockHash = cur.Block.ID()
@@ -43,6 +61,23 @@ func (s *Server) Block(ctx context.Context, request *pbfirehose.SingleBlockReque
 		blockNum = ref.BlockNumber.Num
 	}
 
+	if s.IsDraining() {
+		return nil, firehose.NewErrServerDraining()
+	}
+
+	if s.quotas != nil {
+		if err := s.quotas.Check(dauth.FromContext(ctx)); err != nil {
+			return nil, err
+		}
+	}
+
+	// fetches go through the same hooks as streams, see fetchHookRequest
+	hookRequest := fetchHookRequest(blockNum, request.GetCursor().GetCursor())
+	ctx = s.onRequestStart(withMeteringEndpoint(ctx, MeteringEndpointBlock), hookRequest)
+	defer func() {
+		s.onRequestEnd(ctx, hookRequest, err)
+	}()
+
 	blk, err := s.blockGetter.Get(ctx, blockNum, blockHash, s.logger)
 	if err != nil {
 		if _, ok := status.FromError(err); ok {
@@ -54,19 +89,74 @@ func (s *Server) Block(ctx context.Context, request *pbfirehose.SingleBlockReque
 		return nil, status.Errorf(codes.NotFound, "block %s not found", bstream.NewBlockRef(blockHash, blockNum))
 	}
 
+	header := s.responseHeader(ctx, s.logger)
+	if s.responseHeaders.ResolvedStartBlock {
+		header.Set(ResolvedStartBlockHeader, strconv.FormatUint(blk.Number, 10))
+	}
+	if header.Len() > 0 {
+		if err := grpc.SetHeader(ctx, header); err != nil {
+			s.logger.Warn("cannot set metadata header", zap.Error(err))
+		}
+	}
+
 	protoBlock, err := anypb.New(blk.ToProtocol().(proto.Message))
 	if err != nil {
 		return nil, fmt.Errorf("to any: %w", err)
 	}
 
-	return &pbfirehose.SingleBlockResponse{
+	resp = &pbfirehose.SingleBlockResponse{
 		Block: protoBlock,
-	}, nil
+	}
+	s.onResponse(ctx, hookRequest, &pbfirehose.Response{Block: protoBlock})
+	if s.quotas != nil {
+		// going over the quota with this block is reported on the next request
+		s.quotas.Account(dauth.FromContext(ctx), 1, uint64(proto.Size(resp)))
+	}
+
+	return resp, nil
 }
 
-func (s *Server) Blocks(request *pbfirehose.Request, streamSrv pbfirehose.Stream_BlocksServer) error {
+// fetchHookRequest describes a single block request to the hooks: a request for the
+// fetched block only, resuming from the cursor of the request if any. The response
+// passed to the hooks carries the block, without step nor cursor.
+func fetchHookRequest(blockNum uint64, cursor string) *pbfirehose.Request {
+	return &pbfirehose.Request{
+		StartBlockNum: int64(blockNum),
+		StopBlockNum:  blockNum,
+		Cursor:        cursor,
+	}
+}
+
+func (s *Server) Blocks(request *pbfirehose.Request, streamSrv pbfirehose.Stream_BlocksServer) (err error) {
 	ctx := streamSrv.Context()
+	start := time.Now()
 	metrics.RequestCounter.Inc()
+	defer func() {
+		metrics.StreamTerminations.Inc(status.Code(err).String())
+	}()
+
+	var summary *summaryStream
+	if s.auditWriter != nil {
+		transforms := transformsDescription(s.transformRegistry, request.Transforms)
+		defer func() {
+			entry := &AuditEntry{
+				Endpoint:        MeteringEndpoint(ctx),
+				StartBlock:      request.StartBlockNum,
+				StopBlock:       request.StopBlockNum,
+				Cursor:          request.Cursor,
+				Transforms:      transforms,
+				FinalBlocksOnly: request.FinalBlocksOnly,
+			}
+			if summary != nil {
+				entry.BlocksSent, entry.BytesSent = summary.sent()
+			}
+			s.audit(ctx, entry, start, err, s.logger)
+		}()
+	}
+
+	if s.IsDraining() {
+		return firehose.NewErrServerDraining()
+	}
 
 	logger := logging.Logger(ctx, s.logger)
 
@@ -86,26 +176,197 @@ func (s *Server) Blocks(request *pbfirehose.Request, streamSrv pbfirehose.Stream
 	metrics.ActiveRequests.Inc()
 	defer metrics.ActiveRequests.Dec()
 
-	if os.Getenv("FIREHOSE_SEND_HOSTNAME") != "" {
-		hostname, err := os.Hostname()
+	summary = newSummaryStream(streamSrv, start)
+	streamSrv = summary
+	defer func() {
+		headNum, libNum := s.streamFactory.HeadAndLIBNum()
+		summary.setTrailer(err, headNum, libNum)
+		summary.observe()
+	}()
+
+	// below the send buffer, slowness is measured on what the client actually receives
+	if s.slowConsumerPolicy != nil {
+		slowConsumer := newSlowConsumerStream(summary, newSlowConsumerTracker(s.slowConsumerPolicy, s.streamFactory.HeadNum, logger))
+		defer slowConsumer.close()
+		streamSrv = slowConsumer
+	}
+
+	ranges, err := blockRangesFromContext(ctx)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if ranges == nil && firehose.IsSegmentCursor(request.Cursor) {
+		return status.Errorf(codes.InvalidArgument, "cursor was issued by a multi-range request, send it back along with the same %q header", BlockRangesHeader)
+	}
+
+	header := s.responseHeader(ctx, logger)
+	if anchor := incomingHeader(ctx, StartAnchorHeader); anchor != "" {
+		if ranges != nil {
+			return status.Errorf(codes.InvalidArgument, "%q and %q cannot be used together, each range already sets its start block", StartAnchorHeader, BlockRangesHeader)
+		}
+		if request.Cursor != "" || request.StartBlockNum != 0 {
+			return status.Errorf(codes.InvalidArgument, "start block and cursor must not be set when using %q", StartAnchorHeader)
+		}
+
+		startBlockNum, err := s.streamFactory.ResolveStartAnchor(anchor)
 		if err != nil {
-			hostname = "unknown"
-			logger.Warn("cannot determine hostname, using 'unknown'", zap.Error(err))
+			return err
+		}
+		logger.Info("resolved start anchor", zap.String("anchor", anchor), zap.Uint64("start_block", startBlockNum))
+
+		request.StartBlockNum = int64(startBlockNum)
+		header.Set(ResolvedStartBlockHeader, strconv.FormatUint(startBlockNum, 10))
+	} else if s.responseHeaders.ResolvedStartBlock && ranges == nil {
+		if startBlockNum, ok := s.resolvedStartBlock(request, descendingRequested(ctx)); ok {
+			header.Set(ResolvedStartBlockHeader, strconv.FormatUint(startBlockNum, 10))
+		}
+	}
+
+	var policy *policyStream
+	if s.requestPolicies != nil {
+		tier, requestPolicy := s.requestPolicy(ctx)
+		if err := s.checkRequestPolicy(tier, requestPolicy, request, ranges, descendingRequested(ctx)); err != nil {
+			logger.Info("request rejected by policy", zap.String("tier", tier), zap.Error(err))
+			return err
+		}
+		policy = &policyStream{tier: tier, policy: requestPolicy}
+	}
+
+	var quotas *quotaStream
+	if s.quotas != nil {
+		auth := dauth.FromContext(ctx)
+		if err := s.quotas.Check(auth); err != nil {
+			logger.Info("request rejected by quota", zap.String("user_id", auth.UserID()), zap.Error(err))
+			return err
 		}
-		md := metadata.New(map[string]string{"hostname": hostname})
-		if err := streamSrv.SendHeader(md); err != nil {
+		quotas = newQuotaStream(s.quotas, auth)
+	}
+
+	if header.Len() > 0 {
+		if err := streamSrv.SendHeader(header); err != nil {
 			logger.Warn("cannot send metadata header", zap.Error(err))
 		}
 	}
 
-	isLiveBlock := func(step pbfirehose.ForkStep) bool {
-		if step == pbfirehose.ForkStep_STEP_NEW {
-			return true
+	ctx = s.onRequestStart(ctx, request)
+	hooked := &hookedStream{Stream_BlocksServer: streamSrv, onResponse: func(resp *pbfirehose.Response) {
+		s.onResponse(ctx, request, resp)
+	}}
+	streamSrv = hooked
+	defer func() {
+		hooked.end()
+		s.onRequestEnd(ctx, request, err)
+	}()
+
+	// responses are metered and charged to quotas below the send buffer, like the summary,
+	// so only what reached the client is accounted
+	if quotas != nil {
+		quotas.Stream_BlocksServer = streamSrv
+		streamSrv = quotas
+	}
+
+	var buffer *sendBuffer
+	if s.sendBufferStreamBytes > 0 {
+		buffer = s.newSendBuffer(ctx, streamSrv)
+		streamSrv = buffer
+	}
+
+	// the policy is outermost so blocks refused by it are neither buffered nor accounted
+	if policy != nil {
+		policy.Stream_BlocksServer = streamSrv
+		streamSrv = policy
+	}
+
+	streamCtx, streamDone := s.streams.track(ctx, s.newStreamInfo(ctx, request, start))
+	defer streamDone()
+	summary.stream = activeStreamFromContext(streamCtx)
+
+	if policy != nil {
+		var cancel context.CancelFunc
+		streamCtx, cancel = policy.withDeadline(streamCtx)
+		defer cancel()
+	}
+
+	if ranges != nil {
+		err = s.multiRangeBlocks(streamCtx, request, ranges, streamSrv, logger)
+	} else {
+		err = s.blocks(streamCtx, request, streamSrv, logger)
+	}
+
+	var limited bool
+	if policy != nil && err != nil && ctx.Err() == nil {
+		if policyErr := policy.terminationError(streamCtx); policyErr != nil {
+			logger.Info("stream terminated by request policy", zap.String("tier", policy.tier), zap.Error(policyErr))
+			limited = true
+			err = policyErr
+		}
+	}
+
+	var canceled bool
+	if !limited && err != nil && ctx.Err() == nil && streamCtx.Err() != nil {
+		if cancelErr := summary.stream.canceledError(); cancelErr != nil {
+			logger.Info("stream canceled by operator", zap.Error(cancelErr))
+			canceled = true
+			err = cancelErr
+		}
+	}
+
+	drained := !limited && !canceled && err != nil && ctx.Err() == nil && streamCtx.Err() != nil && s.IsDraining()
+	if drained {
+		logger.Info("stream terminated by server drain")
+		metrics.DrainedStreams.Inc()
+		err = firehose.NewErrServerDraining()
+	}
+
+	var flushErr error
+	if buffer != nil {
+		// when draining, canceled or reaching a policy limit, what was already produced is
+		// still flushed to the client
+		if err != nil && !drained && !canceled && !limited {
+			buffer.discard()
+		} else {
+			flushErr = buffer.close()
+		}
+	}
+
+	if quotas != nil {
+		// the remaining usage is accounted whatever the outcome, going over the quota with
+		// it is reported on the next request
+		quotas.flush()
+		if exceeded := quotas.exceededError(); exceeded != nil && ctx.Err() == nil && (err != nil || flushErr != nil) {
+			if errors.Is(flushErr, exceeded) {
+				flushErr = nil
+			}
+			if !limited {
+				logger.Info("stream terminated by quota", zap.Error(exceeded))
+				limited = true
+				err = exceeded
+			}
 		}
+	}
+
+	if flushErr != nil {
+		logger.Info("unable to flush send buffer probably due to client disconnecting", zap.Error(flushErr))
+		return NewErrSendBlock(flushErr).GRPCStatus().Err()
+	}
+
+	return err
+}
 
-		return false
+func (s *Server) blocks(ctx context.Context, request *pbfirehose.Request, streamSrv pbfirehose.Stream_BlocksServer, logger *zap.Logger) error {
+	descending := descendingRequested(ctx)
+	if !descending && firehose.IsDescendingCursor(request.Cursor) {
+		return status.Errorf(codes.InvalidArgument, "cursor was issued by a descending order request, send it back along with the %q header set to %q", OrderHeader, OrderDescending)
 	}
 
+	var reorgs *reorgConsolidator
+	if consolidatedReorgRequested(ctx) {
+		reorgs = newReorgConsolidator(s.streamFactory.ParentRef, s.streamFactory.SignCursor)
+	}
+
+	tracked := activeStreamFromContext(ctx)
+
 	var blockCount uint64
 	handlerFunc := bstream.HandlerFunc(func(block *bstream.Block, obj interface{}) error {
 		blockCount++
@@ -126,9 +387,28 @@ func (s *Server) Blocks(request *pbfirehose.Request, streamSrv pbfirehose.Stream
 			return nil
 		}
 
+		source := s.streamFactory.BlockSource(block, step)
+		if err := firehose.MeterBlockRead(ctx, source, block); err != nil {
+			return fmt.Errorf("unable to get block payload: %w", err)
+		}
+
+		if reorgs != nil {
+			if protoStep == pbfirehose.ForkStep_STEP_UNDO {
+				reorgs.add(block, cursor)
+				return nil
+			}
+
+			if err := s.sendConsolidatedReorg(ctx, request, reorgs, streamSrv, logger); err != nil {
+				return err
+			}
+		}
+
 		resp := &pbfirehose.Response{
 			Step:   protoStep,
-			Cursor: cursor.ToOpaque(),
+			Cursor: s.streamFactory.SignCursor(cursor),
+		}
+		if descending {
+			resp.Cursor = firehose.EncodeDescendingCursor(resp.Cursor)
 		}
 
 		switch v := obj.(type) {
@@ -146,9 +426,6 @@ func (s *Server) Blocks(request *pbfirehose.Request, streamSrv pbfirehose.Stream
 			return fmt.Errorf("unknown object type %t, cannot marshal to protobuf Any", v)
 		}
 
-		if s.postHookFunc != nil {
-			s.postHookFunc(ctx, resp)
-		}
 		start := time.Now()
 		err := streamSrv.Send(resp)
 		if err != nil {
@@ -156,12 +433,12 @@ func (s *Server) Blocks(request *pbfirehose.Request, streamSrv pbfirehose.Stream
 			return NewErrSendBlock(err)
 		}
 
-		if isLiveBlock(protoStep) {
-			payload, err := block.Payload.Get()
-			if err != nil {
-				return fmt.Errorf("unable to get block payload: %w", err)
-			}
-			dmetering.GetBytesMeter(ctx).AddBytesRead(len(payload))
+		if reorgs != nil {
+			reorgs.sent(block)
+		}
+		tracked.observeBlock(block.Number, source == firehose.BlockSourceHub)
+		if source == firehose.BlockSourceHub && protoStep == pbfirehose.ForkStep_STEP_NEW {
+			observeLiveBlock(ctx, block.Time())
 		}
 
 		level := zap.DebugLevel
@@ -177,20 +454,49 @@ func (s *Server) Blocks(request *pbfirehose.Request, streamSrv pbfirehose.Stream
 	if s.transformRegistry != nil {
 		passthroughTr, err := s.transformRegistry.PassthroughFromTransforms(request.Transforms)
 		if err != nil {
-			return status.Errorf(codes.Internal, "unable to create pre-proc function: %s", err)
+			return firehose.NewErrTransformRejected(err)
 		}
 
 		if passthroughTr != nil {
+			if descending {
+				return status.Error(codes.InvalidArgument, "descending order is not supported with passthrough transforms")
+			}
+			if reorgs != nil {
+				return status.Errorf(codes.InvalidArgument, "%q reorg mode is not supported with passthrough transforms", ReorgModeConsolidated)
+			}
+
+			getRequestMeter(ctx).endpoint.CompareAndSwap(MeteringEndpointBlocks, MeteringEndpointBlocksPassthrough)
+
 			metrics.ActiveSubstreams.Inc()
 			defer metrics.ActiveSubstreams.Dec()
 			metrics.SubstreamsCounter.Inc()
+
+			// the output of the transform only carries cursors, the time of the live blocks
+			// it sends is taken from the blocks read
+			lastRead := &lastReadBlock{}
+			requestCtx := ctx
+			getStream := func(ctx context.Context, handler bstream.Handler, request *pbfirehose.Request, decodeBlock bool, logger *zap.Logger) (*stream.Stream, error) {
+				return s.streamFactory.New(ctx, bstream.HandlerFunc(func(blk *bstream.Block, obj interface{}) error {
+					var step bstream.StepType
+					if stepable, ok := obj.(bstream.Stepable); ok {
+						step = stepable.Step()
+					}
+					if err := firehose.MeterBlockRead(requestCtx, s.streamFactory.BlockSource(blk, step), blk); err != nil {
+						return fmt.Errorf("unable to get block payload: %w", err)
+					}
+
+					lastRead.set(blk)
+					return handler.ProcessBlock(blk, obj)
+				}), request, decodeBlock, logger)
+			}
+
 			outputFunc := func(cursor *bstream.Cursor, message *anypb.Any) error {
 				var blocknum uint64
 				var opaqueCursor string
 				var outStep pbfirehose.ForkStep
 				if cursor != nil {
 					blocknum = cursor.Block.Num()
-					opaqueCursor = cursor.ToOpaque()
+					opaqueCursor = s.streamFactory.SignCursor(cursor)
 
 					protoStep, skip := stepToProto(cursor.Step, request.FinalBlocksOnly)
 					if skip {
@@ -203,15 +509,21 @@ func (s *Server) Blocks(request *pbfirehose.Request, streamSrv pbfirehose.Stream
 					Cursor: opaqueCursor,
 					Block:  message,
 				}
-				if s.postHookFunc != nil {
-					s.postHookFunc(ctx, resp)
-				}
 				start := time.Now()
 				err := streamSrv.Send(resp)
 				if err != nil {
 					logger.Info("stream send error from transform", zap.Uint64("blocknum", blocknum), zap.Error(err))
 					return NewErrSendBlock(err)
 				}
+				if cursor != nil {
+					live := s.streamFactory.IsLive(blocknum)
+					tracked.observeBlock(blocknum, live)
+					if live && outStep == pbfirehose.ForkStep_STEP_NEW {
+						if blockTime, ok := lastRead.timeOf(cursor.Block); ok {
+							observeLiveBlock(ctx, blockTime)
+						}
+					}
+				}
 
 				level := zap.DebugLevel
 				if blocknum%200 == 0 {
@@ -222,7 +534,16 @@ func (s *Server) Blocks(request *pbfirehose.Request, streamSrv pbfirehose.Stream
 			}
 			request.Transforms = nil
 
-			return passthroughTr.Run(ctx, request, s.streamFactory.New, outputFunc)
+			// like the regular path, reaching the stop block is a normal end of stream, which
+			// lets a multi-range request go on with its next segment
+			if err := passthroughTr.Run(ctx, request, getStream, outputFunc); err != nil && !errors.Is(err, stream.ErrStopBlockReached) {
+				var errSendBlock *ErrSendBlock
+				if errors.As(err, &errSendBlock) {
+					return errSendBlock.GRPCStatus().Err()
+				}
+				return err
+			}
+			return nil
 			//  --> will want to start a few firehose instances,sources, manage them, process them...
 			//  --> I give them an output func to print back to the user with the request
 			//   --> I could HERE give him the
@@ -231,18 +552,44 @@ func (s *Server) Blocks(request *pbfirehose.Request, streamSrv pbfirehose.Stream
 		return status.Errorf(codes.Unimplemented, "no transforms registry configured within this instance")
 	}
 
-	ctx = s.initFunc(ctx, request)
-	str, err := s.streamFactory.New(ctx, handlerFunc, request, true, logger) // firehose always want decoded the blocks
+	var str blocksRunner
+	var err error
+	if descending {
+		str, err = s.streamFactory.NewReverseBackfill(ctx, handlerFunc, request, true, logger)
+	} else if s.streamFactory.CanBackfill(ctx, request) {
+		str, err = s.streamFactory.NewBackfill(ctx, handlerFunc, request, true, logger)
+	} else {
+		str, err = s.streamFactory.New(ctx, handlerFunc, request, true, logger) // firehose always want decoded the blocks
+	}
 	if err != nil {
 		return err
 	}
 
 	err = str.Run(ctx)
+	if err != nil && blockCount == 0 && request.Cursor != "" && firehose.IsUnresolvedCursorError(err) {
+		// nothing was sent yet, the cursor can still be recovered by undoing its fork
+		logger.Info("cursor block is on a fork unknown to the stream, attempting recovery", zap.Error(err))
+		recovery, recoveryErr := s.streamFactory.NewForkRecovery(ctx, handlerFunc, request, true, logger)
+		if recoveryErr != nil {
+			err = recoveryErr
+		} else {
+			err = recovery.Run(ctx)
+		}
+	}
+
+	if reorgs != nil {
+		// undone blocks right before the end of the stream are still sent, the client
+		// must not resume from a cursor on the abandoned fork
+		if sendErr := s.sendConsolidatedReorg(ctx, request, reorgs, streamSrv, logger); sendErr != nil {
+			logger.Info("unable to send pending consolidated reorg at the end of the stream", zap.Error(sendErr))
+		}
+	}
+
 	meter := getRequestMeter(ctx)
 
 	fields := []zap.Field{
-		zap.Uint64("block_sent", meter.blocks),
-		zap.Int("egress_bytes", meter.egressBytes),
+		zap.Uint64("block_sent", meter.blocks.Load()),
+		zap.Int64("egress_bytes", meter.egressBytes.Load()),
 		zap.Error(err),
 	}
 
@@ -256,41 +603,34 @@ func (s *Server) Blocks(request *pbfirehose.Request, streamSrv pbfirehose.Stream
 	}
 	logger.Info("firehose process completed", fields...)
 	if err != nil {
-		if errors.Is(err, stream.ErrStopBlockReached) {
-			logger.Info("stream of blocks reached end block")
-			return nil
-		}
-
-		if errors.Is(err, context.Canceled) {
-			if ctx.Err() != context.Canceled {
-				logger.Debug("stream of blocks ended with context canceled, but our own context was not canceled", zap.Error(err))
-			}
-			return status.Error(codes.Canceled, "source canceled")
-		}
-
-		if errors.Is(err, context.DeadlineExceeded) {
-			logger.Info("stream of blocks ended with context deadline exceeded", zap.Error(err))
-			return status.Error(codes.DeadlineExceeded, "source deadline exceeded")
-		}
+		return streamErrorToStatus(ctx, err, request.Cursor, logger)
+	}
 
-		var errInvalidArg *stream.ErrInvalidArg
-		if errors.As(err, &errInvalidArg) {
-			return status.Error(codes.InvalidArgument, errInvalidArg.Error())
-		}
+	logger.Error("source is not expected to terminate gracefully, should stop at block or continue forever")
+	return status.Error(codes.Internal, "unexpected stream completion")
 
-		var errSendBlock *ErrSendBlock
-		if errors.As(err, &errSendBlock) {
-			logger.Info("unable to send block probably due to client disconnecting", zap.Error(errSendBlock.inner))
-			return status.Error(codes.Unavailable, errSendBlock.inner.Error())
-		}
+}
 
-		logger.Info("unexpected stream of blocks termination", zap.Error(err))
-		return status.Errorf(codes.Internal, "unexpected stream termination")
+// sendConsolidatedReorg sends the undone blocks accumulated by `reorgs`, if any
+func (s *Server) sendConsolidatedReorg(ctx context.Context, request *pbfirehose.Request, reorgs *reorgConsolidator, streamSrv pbfirehose.Stream_BlocksServer, logger *zap.Logger) error {
+	if !reorgs.pending() {
+		return nil
 	}
 
-	logger.Error("source is not expected to terminate gracefully, should stop at block or continue forever")
-	return status.Error(codes.Internal, "unexpected stream completion")
+	resp, err := reorgs.flush()
+	if err != nil {
+		return err
+	}
+	if err := streamSrv.Send(resp); err != nil {
+		logger.Info("stream send error on consolidated reorg", zap.String("cursor", resp.Cursor), zap.Error(err))
+		return NewErrSendBlock(err)
+	}
+	return nil
+}
 
+// blocksRunner is either a regular stream or a parallel backfill
+type blocksRunner interface {
+	Run(ctx context.Context) error
 }
 
 func stepToProto(step bstream.StepType, finalBlocksOnly bool) (outStep pbfirehose.ForkStep, skip bool) {
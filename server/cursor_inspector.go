@@ -0,0 +1,18 @@
+package server
+
+import (
+	"context"
+
+	pbcursor "github.com/streamingfast/firehose/pb/streamingfast/firehose/cursor/v1"
+)
+
+// InspectCursor implements the `streamingfast.firehose.cursor.v1.CursorInspector`
+// service, see firehose.StreamFactory.InspectCursor.
+func (s *Server) InspectCursor(ctx context.Context, request *pbcursor.InspectCursorRequest) (*pbcursor.InspectCursorResponse, error) {
+	info, err := s.streamFactory.InspectCursor(ctx, request.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	return info.ToProto(), nil
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/dstore"
+	"github.com/streamingfast/firehose"
+	"github.com/streamingfast/firehose/client"
+	pbcursor "github.com/streamingfast/firehose/pb/streamingfast/firehose/cursor/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func newCursorInspectorConn(t *testing.T, s *Server) *grpc.ClientConn {
+	t.Helper()
+
+	listener := bufconn.Listen(1024 * 1024)
+	gs := grpc.NewServer()
+	pbcursor.RegisterCursorInspectorServer(gs, s)
+	reflection.Register(gs)
+	go gs.Serve(listener)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.Dial("bufnet", grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	}), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestCursorInspectorReflection(t *testing.T) {
+	conn := newCursorInspectorConn(t, &Server{})
+
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+	require.NoError(t, err)
+
+	require.NoError(t, stream.Send(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: pbcursor.CursorInspector_ServiceDesc.ServiceName},
+	}))
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+
+	files := resp.GetFileDescriptorResponse().GetFileDescriptorProto()
+	require.NotEmpty(t, files, "reflection error: %v", resp.GetErrorResponse())
+
+	file := &descriptorpb.FileDescriptorProto{}
+	require.NoError(t, proto.Unmarshal(files[0], file))
+	assert.Equal(t, "streamingfast/firehose/cursor/v1/cursor_inspector.proto", file.GetName())
+	require.Len(t, file.GetService(), 1)
+	assert.Equal(t, "CursorInspector", file.GetService()[0].GetName())
+}
+
+func TestCursorInspectorInspectCursor(t *testing.T) {
+	mergedStore := dstore.NewMockStore(nil)
+	mergedStore.OpenObjectFunc = func(context.Context, string) (io.ReadCloser, error) {
+		return nil, dstore.ErrNotFound
+	}
+	conn := newCursorInspectorConn(t, &Server{streamFactory: firehose.NewStreamFactory(mergedStore, nil, nil, nil)})
+
+	// not representable exactly as a float64
+	ref := bstream.NewBlockRef("block", 1<<60+1)
+	cursor := (&bstream.Cursor{Step: bstream.StepNew, Block: ref, HeadBlock: ref, LIB: bstream.NewBlockRef("lib", 1<<60)}).ToOpaque()
+
+	info, err := client.InspectCursor(context.Background(), conn, cursor)
+	require.NoError(t, err)
+	assert.Equal(t, bstream.StepNew, info.Step)
+	assert.Equal(t, ref, info.Block)
+	assert.Equal(t, uint64(1<<60), info.LIB.Num())
+	assert.False(t, info.Resumable)
+	assert.Equal(t, "cursor block is not known by this server", info.NotResumableReason)
+}
@@ -0,0 +1,18 @@
+package server
+
+import (
+	"context"
+	"strings"
+)
+
+// OrderHeader is the request metadata key used by clients to choose the order in which
+// blocks are streamed. Setting it to OrderDescending streams the final blocks of a
+// bounded request from its stop block down to its start block, see
+// firehose.StreamFactory.NewReverseBackfill for the requirements and cursor semantics.
+const OrderHeader = "x-firehose-order"
+
+const OrderDescending = "descending"
+
+func descendingRequested(ctx context.Context) bool {
+	return strings.EqualFold(incomingHeader(ctx, OrderHeader), OrderDescending)
+}
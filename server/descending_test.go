@@ -0,0 +1,45 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/streamingfast/firehose"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestDescendingCursors(t *testing.T) {
+	s, _ := newMeteringTestServer(t)
+	descendingCtx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(OrderHeader, OrderDescending))
+
+	blockNums := func(srv *collectingBlocksServer) (out []uint64) {
+		for _, resp := range srv.sent() {
+			require.True(t, firehose.IsDescendingCursor(resp.Cursor))
+			cursor, err := firehose.DecodeCursor(resp.Cursor)
+			require.NoError(t, err)
+			out = append(out, cursor.Block.Num())
+		}
+		return
+	}
+
+	srv := newCollectingBlocksServer(descendingCtx)
+	require.NoError(t, s.Blocks(&pbfirehose.Request{StartBlockNum: 2, StopBlockNum: 4, FinalBlocksOnly: true}, srv))
+	assert.Equal(t, []uint64{4, 3, 2}, blockNums(srv))
+	resumeCursor := srv.sent()[1].Cursor
+
+	t.Run("resumed", func(t *testing.T) {
+		srv := newCollectingBlocksServer(descendingCtx)
+		require.NoError(t, s.Blocks(&pbfirehose.Request{StartBlockNum: 2, StopBlockNum: 4, FinalBlocksOnly: true, Cursor: resumeCursor}, srv))
+		assert.Equal(t, []uint64{2}, blockNums(srv))
+	})
+
+	t.Run("resumed without order header", func(t *testing.T) {
+		err := s.Blocks(&pbfirehose.Request{StartBlockNum: 2, StopBlockNum: 4, FinalBlocksOnly: true, Cursor: resumeCursor}, newCollectingBlocksServer(context.Background()))
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
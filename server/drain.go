@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/firehose/metrics"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+// activeStreams keeps track of the in-flight `Blocks` streams so they can be
+// terminated when the server drains, and listed or canceled by operators.
+type activeStreams struct {
+	mu      sync.Mutex
+	nextID  uint64
+	streams map[uint64]*activeStream
+	changed chan struct{}
+
+	draining *atomic.Bool
+}
+
+type activeStream struct {
+	info   StreamInfo
+	cancel context.CancelFunc
+
+	// canceled is the error the stream terminates with when an operator canceled it
+	canceled atomic.Error
+
+	currentBlock atomic.Uint64
+	blocksSent   atomic.Uint64
+	bytesSent    atomic.Uint64
+	live         atomic.Bool
+
+	// lastLiveBlockTime is the time of the last live block sent to the stream, zero
+	// while it did not reach the live segment of the chain.
+	lastLiveBlockTime atomic.Time
+}
+
+type activeStreamKey int
+
+func newActiveStreams() *activeStreams {
+	return &activeStreams{
+		streams:  make(map[uint64]*activeStream),
+		changed:  make(chan struct{}, 1),
+		draining: atomic.NewBool(false),
+	}
+}
+
+// track registers a stream described by `info`, its ID being assigned here. The returned
+// context is canceled when the server drains or an operator cancels the stream, and
+// `done` must be called once the stream terminated.
+func (a *activeStreams) track(ctx context.Context, info StreamInfo) (streamCtx context.Context, done func()) {
+	streamCtx, cancel := context.WithCancel(ctx)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.draining.Load() {
+		cancel()
+		return streamCtx, func() {}
+	}
+
+	a.nextID++
+	id := a.nextID
+	info.ID = id
+	stream := &activeStream{info: info, cancel: cancel}
+	a.streams[id] = stream
+
+	return context.WithValue(streamCtx, activeStreamKey(0), stream), func() {
+		cancel()
+
+		a.mu.Lock()
+		delete(a.streams, id)
+		a.mu.Unlock()
+
+		select {
+		case a.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// activeStreamFromContext returns the stream tracked in `ctx`, nil if it is not tracked
+func activeStreamFromContext(ctx context.Context) *activeStream {
+	stream, _ := ctx.Value(activeStreamKey(0)).(*activeStream)
+	return stream
+}
+
+func (a *activeStreams) count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.streams)
+}
+
+// IsDraining returns true once Drain has been called, no new request is accepted anymore.
+func (s *Server) IsDraining() bool {
+	return s.streams.draining.Load()
+}
+
+// Drain stops accepting new requests, which also makes the health check report the
+// server as not ready, and asks in-flight streams to terminate once their current
+// block is sent. Those streams end with an `Unavailable` error with reason
+// `SERVER_DRAINING` and the last cursor sent in the `x-firehose-last-cursor` trailer.
+// It returns once all streams terminated or after `timeout`.
+func (s *Server) Drain(timeout time.Duration) {
+	s.streams.mu.Lock()
+	s.streams.draining.Store(true)
+	inFlight := len(s.streams.streams)
+	for _, stream := range s.streams.streams {
+		stream.cancel()
+	}
+	s.streams.mu.Unlock()
+
+	metrics.DrainingStreams.SetUint64(uint64(inFlight))
+	s.logger.Info("draining firehose server", zap.Int("in_flight_streams", inFlight), zap.Duration("timeout", timeout))
+
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		remaining := s.streams.count()
+		metrics.DrainingStreams.SetUint64(uint64(remaining))
+		if remaining == 0 {
+			s.logger.Info("firehose server drained", zap.Int("drained_streams", inFlight))
+			return
+		}
+
+		select {
+		case <-s.streams.changed:
+		case <-ticker.C:
+			s.logger.Info("draining firehose server", zap.Int("remaining_streams", remaining))
+		case <-deadline:
+			s.logger.Warn("firehose server drain timed out, remaining streams will be cut", zap.Int("remaining_streams", remaining))
+			return
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDrain(t *testing.T) {
+	s := &Server{logger: zap.NewNop(), streams: newActiveStreams()}
+
+	streamCtx, done := s.streams.track(context.Background(), StreamInfo{})
+	go func() {
+		<-streamCtx.Done()
+		done()
+	}()
+
+	drained := make(chan struct{})
+	go func() {
+		s.Drain(5 * time.Second)
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		require.Fail(t, "drain did not complete")
+	}
+
+	assert.True(t, s.IsDraining())
+	assert.Equal(t, 0, s.streams.count())
+
+	lateCtx, lateDone := s.streams.track(context.Background(), StreamInfo{})
+	defer lateDone()
+	assert.Error(t, lateCtx.Err(), "streams started while draining are canceled right away")
+}
+
+func TestDrainTimeout(t *testing.T) {
+	s := &Server{logger: zap.NewNop(), streams: newActiveStreams()}
+
+	_, done := s.streams.track(context.Background(), StreamInfo{})
+	defer done()
+
+	start := time.Now()
+	s.Drain(50 * time.Millisecond)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, 1, s.streams.count())
+}
@@ -1,19 +1,94 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/bstream/stream"
+	"github.com/streamingfast/firehose"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type ErrSendBlock struct {
 	inner error
 }
 
-func NewErrSendBlock(inner error) ErrSendBlock {
-	return ErrSendBlock{
+func NewErrSendBlock(inner error) *ErrSendBlock {
+	return &ErrSendBlock{
 		inner: inner,
 	}
 }
 
-func (e ErrSendBlock) Error() string {
+func (e *ErrSendBlock) Error() string {
 	return fmt.Sprintf("send error: %s", e.inner)
 }
+
+func (e *ErrSendBlock) Unwrap() error {
+	return e.inner
+}
+
+// GRPCStatus is `CLIENT_TOO_SLOW` when the send was abandoned by the slow consumer
+// watchdog, `SEND_FAILED` otherwise
+func (e *ErrSendBlock) GRPCStatus() *status.Status {
+	var errClientTooSlow *firehose.ErrClientTooSlow
+	if errors.As(e.inner, &errClientTooSlow) {
+		return errClientTooSlow.GRPCStatus()
+	}
+	return firehose.NewStatusWithReason(codes.Unavailable, firehose.ReasonSendFailed, e.inner.Error(), nil)
+}
+
+// streamErrorToStatus converts the error that terminated a stream of blocks into the
+// gRPC error sent back to the client. A nil error means the stream completed normally.
+func streamErrorToStatus(ctx context.Context, err error, startCursor string, logger *zap.Logger) error {
+	if errors.Is(err, stream.ErrStopBlockReached) {
+		logger.Info("stream of blocks reached end block")
+		return nil
+	}
+
+	if errors.Is(err, context.Canceled) {
+		if ctx.Err() != context.Canceled {
+			logger.Debug("stream of blocks ended with context canceled, but our own context was not canceled", zap.Error(err))
+		}
+		return status.Error(codes.Canceled, "source canceled")
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		logger.Info("stream of blocks ended with context deadline exceeded", zap.Error(err))
+		return status.Error(codes.DeadlineExceeded, "source deadline exceeded")
+	}
+
+	var errSendBlock *ErrSendBlock
+	if errors.As(err, &errSendBlock) {
+		logger.Info("unable to send block probably due to client disconnecting", zap.Error(errSendBlock.inner))
+		return errSendBlock.GRPCStatus().Err()
+	}
+
+	var errWithStatus interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &errWithStatus) {
+		return errWithStatus.GRPCStatus().Err()
+	}
+
+	if startCursor != "" && firehose.IsUnresolvedCursorError(err) {
+		return firehose.NewErrCursorOnUnknownFork(cursorBlockRef(startCursor), err).GRPCStatus().Err()
+	}
+
+	var errInvalidArg *stream.ErrInvalidArg
+	if errors.As(err, &errInvalidArg) {
+		return status.Error(codes.InvalidArgument, errInvalidArg.Error())
+	}
+
+	logger.Info("unexpected stream of blocks termination", zap.Error(err))
+	return status.Errorf(codes.Internal, "unexpected stream termination")
+}
+
+func cursorBlockRef(opaqueCursor string) bstream.BlockRef {
+	cursor, err := firehose.DecodeCursor(opaqueCursor)
+	if err != nil {
+		return bstream.BlockRefEmpty
+	}
+	return cursor.Block
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/bstream/stream"
+	"github.com/streamingfast/bstream/transform"
+	"github.com/streamingfast/dstore"
+	"github.com/streamingfast/firehose"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStreamErrorToStatus(t *testing.T) {
+	cursor := (&bstream.Cursor{
+		Step:      bstream.StepNew,
+		Block:     bstream.NewBlockRef("12b", 12),
+		HeadBlock: bstream.NewBlockRef("12b", 12),
+		LIB:       bstream.NewBlockRef("10a", 10),
+	}).ToOpaque()
+
+	tests := []struct {
+		name           string
+		err            error
+		cursor         string
+		expectNil      bool
+		expectedCode   codes.Code
+		expectedReason string
+	}{
+		{"stop block reached", stream.ErrStopBlockReached, cursor, true, codes.OK, ""},
+		{"canceled", fmt.Errorf("running: %w", context.Canceled), cursor, false, codes.Canceled, ""},
+		{"deadline exceeded", context.DeadlineExceeded, cursor, false, codes.DeadlineExceeded, ""},
+		{"send block", fmt.Errorf("handler: %w", NewErrSendBlock(io.EOF)), cursor, false, codes.Unavailable, firehose.ReasonSendFailed},
+		{"invalid arg", stream.NewErrInvalidArg("start block 10 is after stop block 5"), "", false, codes.InvalidArgument, ""},
+		{"resolve cursor", stream.NewErrInvalidArg("%s: block not linkable", bstream.ErrResolveCursor), cursor, false, codes.FailedPrecondition, firehose.ReasonCursorOnUnknownFork},
+		{"wrapped typed error", fmt.Errorf("processing: %w", firehose.NewErrStoreUnavailable("merged blocks", io.ErrUnexpectedEOF)), cursor, false, codes.Unavailable, firehose.ReasonStoreUnavailable},
+		{"client too slow", firehose.NewErrClientTooSlow(cursor, "lagging"), cursor, false, codes.ResourceExhausted, firehose.ReasonClientTooSlow},
+		{"send abandoned by slow consumer watchdog", NewErrSendBlock(firehose.NewErrClientTooSlow(cursor, "send blocked")), cursor, false, codes.ResourceExhausted, firehose.ReasonClientTooSlow},
+		{"unknown", fmt.Errorf("boom"), cursor, false, codes.Internal, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := streamErrorToStatus(context.Background(), test.err, test.cursor, zap.NewNop())
+			if test.expectNil {
+				require.NoError(t, err)
+				return
+			}
+
+			st, ok := status.FromError(err)
+			require.True(t, ok)
+			assert.Equal(t, test.expectedCode, st.Code())
+
+			if test.expectedReason != "" {
+				require.Len(t, st.Details(), 1)
+				info := st.Details()[0].(*errdetails.ErrorInfo)
+				assert.Equal(t, test.expectedReason, info.Reason)
+			}
+		})
+	}
+}
+
+func TestStreamErrorToStatus_CursorOnUnknownForkReportsCursorBlock(t *testing.T) {
+	cursor := (&bstream.Cursor{
+		Step:      bstream.StepNew,
+		Block:     bstream.NewBlockRef("12b", 12),
+		HeadBlock: bstream.NewBlockRef("12b", 12),
+		LIB:       bstream.NewBlockRef("10a", 10),
+	}).ToOpaque()
+
+	err := streamErrorToStatus(context.Background(), stream.NewErrInvalidArg("%s", bstream.ErrResolveCursor), cursor, zap.NewNop())
+	st, _ := status.FromError(err)
+	info := st.Details()[0].(*errdetails.ErrorInfo)
+	assert.Equal(t, "12", info.Metadata["block_num"])
+	assert.Equal(t, "12b", info.Metadata["block_id"])
+}
+
+func TestBlocksStoreUnavailableMidStream(t *testing.T) {
+	srv := newCollectingBlocksServer(context.Background())
+
+	mergedStore := dstore.NewMockStore(nil)
+	mergedStore.SetFile("0000000000", []byte(strings.Join([]string{
+		bstream.TestJSONBlockWithLIBNum("00000002a", "00000001a", 1),
+		bstream.TestJSONBlockWithLIBNum("00000003a", "00000002a", 2),
+	}, "\n")))
+	// the store breaks once the blocks of the first file were sent
+	mergedStore.FileExistsFunc = func(_ context.Context, base string) (bool, error) {
+		if base == "0000000000" {
+			return true, nil
+		}
+		assert.Eventually(t, func() bool { return len(srv.sent()) > 0 }, 5*time.Second, time.Millisecond)
+		return false, fmt.Errorf("connection reset by peer")
+	}
+
+	s := &Server{
+		streamFactory:     firehose.NewStreamFactory(mergedStore, nil, nil, transform.NewRegistry()),
+		transformRegistry: transform.NewRegistry(),
+		logger:            zap.NewNop(),
+		streams:           newActiveStreams(),
+	}
+	s.installDefaultHooks()
+
+	err := s.Blocks(&pbfirehose.Request{StartBlockNum: 2, StopBlockNum: 150}, srv)
+	require.Error(t, err)
+	assert.NotEmpty(t, srv.sent())
+
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.Unavailable, st.Code())
+	require.Len(t, st.Details(), 1)
+	info := st.Details()[0].(*errdetails.ErrorInfo)
+	assert.Equal(t, firehose.ReasonStoreUnavailable, info.Reason)
+	assert.Equal(t, "merged blocks", info.Metadata["store"])
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	"github.com/streamingfast/dauth"
+	"github.com/streamingfast/dmetering"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// RequestStartHook is called when a `Blocks` request starts streaming, the returned
+// context is used for the rest of the request and passed to the other hooks. `Block`
+// requests go through the hooks too, as a request for the fetched block only with a
+// single response, MeteringEndpoint telling them apart.
+type RequestStartHook func(ctx context.Context, request *pbfirehose.Request, auth dauth.TrustedHeaders) context.Context
+
+// ResponseHook is called with each response once it was sent to the client, responses
+// refused by a request policy, dropped by the send buffer or that could not be sent are
+// not seen by hooks. With a send buffer, response hooks are called from its goroutine.
+type ResponseHook func(ctx context.Context, request *pbfirehose.Request, auth dauth.TrustedHeaders, response *pbfirehose.Response)
+
+// RequestEndHook is called once a request terminated, `err` being the error returned
+// to the client.
+type RequestEndHook func(ctx context.Context, request *pbfirehose.Request, auth dauth.TrustedHeaders, err error)
+
+// WithRequestStartHook adds a hook called when a request starts, hooks are called in
+// the order they were added, after the default metering hooks.
+func WithRequestStartHook(hook RequestStartHook) Option {
+	return func(s *Server) {
+		s.requestStartHooks = append(s.requestStartHooks, hook)
+	}
+}
+
+// WithResponseHook adds a hook called for each response, hooks are called in the order
+// they were added, after the default metering hooks.
+func WithResponseHook(hook ResponseHook) Option {
+	return func(s *Server) {
+		s.responseHooks = append(s.responseHooks, hook)
+	}
+}
+
+// WithRequestEndHook adds a hook called when a request ends, hooks are called in the
+// order they were added, after the default metering hooks.
+func WithRequestEndHook(hook RequestEndHook) Option {
+	return func(s *Server) {
+		s.requestEndHooks = append(s.requestEndHooks, hook)
+	}
+}
+
+// WithoutDefaultMeteringHooks removes the default hooks emitting `dmetering` events,
+// to replace them with custom ones.
+func WithoutDefaultMeteringHooks() Option {
+	return func(s *Server) {
+		s.disableDefaultMeteringHooks = true
+	}
+}
+
+// installDefaultHooks puts the default metering hooks in front of the configured ones,
+// it is called once all options are applied.
+func (s *Server) installDefaultHooks() {
+	if s.disableDefaultMeteringHooks {
+		return
+	}
+	s.metering = &meteringHooks{aggregation: s.meteringAggregation, emit: dmetering.Emit}
+	s.requestStartHooks = append([]RequestStartHook{s.metering.requestStart}, s.requestStartHooks...)
+	s.responseHooks = append([]ResponseHook{s.metering.response}, s.responseHooks...)
+	s.requestEndHooks = append([]RequestEndHook{s.metering.requestEnd}, s.requestEndHooks...)
+}
+
+func (s *Server) onRequestStart(ctx context.Context, request *pbfirehose.Request) context.Context {
+	ctx = withRequestMeter(ctx)
+	if requestMeter := getRequestMeter(ctx); requestMeter.endpoint.Load() == "" {
+		requestMeter.endpoint.Store(MeteringEndpointBlocks)
+	}
+
+	auth := dauth.FromContext(ctx)
+	for _, hook := range s.requestStartHooks {
+		ctx = hook(ctx, request, auth)
+	}
+	return ctx
+}
+
+func (s *Server) onResponse(ctx context.Context, request *pbfirehose.Request, response *pbfirehose.Response) {
+	requestMeter := getRequestMeter(ctx)
+	requestMeter.blocks.Inc()
+	requestMeter.egressBytes.Add(int64(proto.Size(response)))
+
+	auth := dauth.FromContext(ctx)
+	for _, hook := range s.responseHooks {
+		hook(ctx, request, auth, response)
+	}
+}
+
+func (s *Server) onRequestEnd(ctx context.Context, request *pbfirehose.Request, err error) {
+	auth := dauth.FromContext(ctx)
+	for _, hook := range s.requestEndHooks {
+		hook(ctx, request, auth, err)
+	}
+}
+
+// hookedStream calls the response hooks with each response that reached the client. A
+// send abandoned by the send buffer can still complete once the request ended, it is
+// then not passed to the hooks, the request-end hooks being the last ones called.
+type hookedStream struct {
+	pbfirehose.Stream_BlocksServer
+
+	onResponse func(*pbfirehose.Response)
+
+	mu    sync.Mutex
+	ended bool
+}
+
+func (h *hookedStream) Send(resp *pbfirehose.Response) error {
+	if err := h.Stream_BlocksServer.Send(resp); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.ended {
+		h.onResponse(resp)
+	}
+	return nil
+}
+
+// end waits for the response hooks being called, if any, and prevents further calls
+func (h *hookedStream) end() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ended = true
+}
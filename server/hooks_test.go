@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/streamingfast/dauth"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/status"
+)
+
+type hookKey string
+
+func TestHooksChained(t *testing.T) {
+	var calls []string
+	s := &Server{}
+	for _, opt := range []Option{
+		WithoutDefaultMeteringHooks(),
+		WithRequestStartHook(func(ctx context.Context, _ *pbfirehose.Request, auth dauth.TrustedHeaders) context.Context {
+			calls = append(calls, "start1:"+auth.UserID())
+			return context.WithValue(ctx, hookKey("first"), "value")
+		}),
+		WithRequestStartHook(func(ctx context.Context, _ *pbfirehose.Request, _ dauth.TrustedHeaders) context.Context {
+			calls = append(calls, "start2:"+ctx.Value(hookKey("first")).(string))
+			return ctx
+		}),
+		WithResponseHook(func(ctx context.Context, request *pbfirehose.Request, _ dauth.TrustedHeaders, response *pbfirehose.Response) {
+			calls = append(calls, "response:"+response.Cursor)
+		}),
+		WithRequestEndHook(func(ctx context.Context, _ *pbfirehose.Request, _ dauth.TrustedHeaders, err error) {
+			calls = append(calls, "end:"+err.Error())
+		}),
+	} {
+		opt(s)
+	}
+	s.installDefaultHooks()
+
+	request := &pbfirehose.Request{}
+	ctx := dauth.WithTrustedHeaders(context.Background(), dauth.TrustedHeaders{dauth.SFHeaderUserID: "user"})
+
+	ctx = s.onRequestStart(ctx, request)
+	s.onResponse(ctx, request, &pbfirehose.Response{Cursor: "c1"})
+	s.onResponse(ctx, request, &pbfirehose.Response{Cursor: "c2"})
+	s.onRequestEnd(ctx, request, errors.New("done"))
+
+	assert.Equal(t, []string{"start1:user", "start2:value", "response:c1", "response:c2", "end:done"}, calls)
+	assert.Equal(t, uint64(2), getRequestMeter(ctx).blocks.Load())
+}
+
+func TestDefaultMeteringHooks(t *testing.T) {
+	s := &Server{}
+	WithResponseHook(func(context.Context, *pbfirehose.Request, dauth.TrustedHeaders, *pbfirehose.Response) {})(s)
+	s.installDefaultHooks()
+
+	assert.Len(t, s.requestStartHooks, 1)
+	assert.Len(t, s.responseHooks, 2)
+}
+
+func TestFetchHooks(t *testing.T) {
+	s, emitter := newMeteringTestServer(t)
+	s.requestStartHooks, s.responseHooks, s.requestEndHooks = nil, nil, nil
+
+	var calls []string
+	WithRequestStartHook(func(ctx context.Context, request *pbfirehose.Request, _ dauth.TrustedHeaders) context.Context {
+		calls = append(calls, fmt.Sprintf("start:%s:%d-%d", MeteringEndpoint(ctx), request.StartBlockNum, request.StopBlockNum))
+		return ctx
+	})(s)
+	WithResponseHook(func(_ context.Context, _ *pbfirehose.Request, _ dauth.TrustedHeaders, response *pbfirehose.Response) {
+		calls = append(calls, fmt.Sprintf("response:%t", response.Block != nil))
+	})(s)
+	WithRequestEndHook(func(_ context.Context, _ *pbfirehose.Request, _ dauth.TrustedHeaders, err error) {
+		calls = append(calls, fmt.Sprintf("end:%s", status.Code(err)))
+	})(s)
+
+	fetch := func(num uint64) error {
+		_, err := s.Block(context.Background(), &pbfirehose.SingleBlockRequest{
+			Reference: &pbfirehose.SingleBlockRequest_BlockNumber_{BlockNumber: &pbfirehose.SingleBlockRequest_BlockNumber{Num: num}},
+		})
+		return err
+	}
+
+	require.NoError(t, fetch(3))
+	assert.Equal(t, []string{"start:" + MeteringEndpointBlock + ":3-3", "response:true", "end:OK"}, calls)
+
+	calls = nil
+	require.Error(t, fetch(42))
+	assert.Equal(t, []string{"start:" + MeteringEndpointBlock + ":42-42", "end:NotFound"}, calls)
+
+	assert.Empty(t, emitter.events, "default metering hooks removed")
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/logging"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func init() {
+	logging.InstantiateLoggers()
+
+	bstream.GetBlockPayloadSetter = bstream.MemoryBlockPayloadSetter
+	bstream.GetBlockReaderFactory = bstream.BlockReaderFactoryFunc(func(reader io.Reader) (bstream.BlockReader, error) {
+		return &testBlockReader{scanner: bufio.NewScanner(reader)}, nil
+	})
+	bstream.GetBlockDecoder = bstream.BlockDecoderFunc(func(blk *bstream.Block) (interface{}, error) {
+		return wrapperspb.String(blk.Id), nil
+	})
+}
+
+// testBlockReader reads the blocks of bstream.TestJSONBlockWithLIBNum like
+// bstream.TestBlockReaderFactory, without assigning bstream.GetBlockPayloadSetter on
+// every block, which races when several sources read blocks concurrently.
+type testBlockReader struct {
+	scanner *bufio.Scanner
+}
+
+func (r *testBlockReader) Read() (*bstream.Block, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	content := r.scanner.Text()
+	obj := &bstream.ParsableTestBlock{}
+	if err := json.Unmarshal([]byte(content), obj); err != nil {
+		return nil, fmt.Errorf("unable to read block %q: %w", content, err)
+	}
+
+	blk := testBlock(obj.ID, obj.PreviousID)
+	if obj.Number != 0 {
+		blk.Number = obj.Number
+	}
+	blk.LibNum = obj.LIBNum
+	return bstream.MemoryBlockPayloadSetter(blk, []byte(content))
+}
+
+// testBlock is bstream.TestBlock without a payload, the number being read from the
+// first 8 hex characters of the ID.
+func testBlock(id, prev string) *bstream.Block {
+	padded := id
+	if len(padded) < 8 { // shorter version, like 8a for 00000008a
+		padded = fmt.Sprintf("%09s", padded)
+	}
+
+	var number uint64
+	fmt.Sscanf(padded[:8], "%x", &number)
+	return &bstream.Block{Id: id, Number: number, PreviousId: prev}
+}
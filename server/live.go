@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/firehose/metrics"
+)
+
+// liveLagReportInterval is how often the worst live lag gauge is computed
+const liveLagReportInterval = time.Second
+
+// observeLiveBlock records that a live block produced at `blockTime` was sent to the
+// stream tracked in `ctx`, measuring how far behind real time the stream is.
+func observeLiveBlock(ctx context.Context, blockTime time.Time) {
+	metrics.LiveStreamLatency.ObserveSince(blockTime)
+
+	if stream := activeStreamFromContext(ctx); stream != nil {
+		stream.lastLiveBlockTime.Store(blockTime)
+	}
+}
+
+// runLiveLagReporter updates the worst live lag gauge every `interval` until `stop` is
+// closed, so that streams stuck on a block keep lagging more as time passes.
+func (a *activeStreams) runLiveLagReporter(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.reportWorstLiveLag()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// reportWorstLiveLag sets the worst lag gauge from the last live block sent to each
+// active stream
+func (a *activeStreams) reportWorstLiveLag() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var worst time.Duration
+	for _, stream := range a.streams {
+		lastLiveBlockTime := stream.lastLiveBlockTime.Load()
+		if lastLiveBlockTime.IsZero() {
+			continue
+		}
+		if lag := time.Since(lastLiveBlockTime); lag > worst {
+			worst = lag
+		}
+	}
+	metrics.LiveStreamWorstLag.SetFloat64(worst.Seconds())
+}
+
+// lastReadBlock remembers the last block read by the stream of a passthrough transform,
+// whose output only references blocks by their cursor.
+type lastReadBlock struct {
+	mu   sync.Mutex
+	id   string
+	time time.Time
+}
+
+func (l *lastReadBlock) set(blk *bstream.Block) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.id = blk.Id
+	l.time = blk.Time()
+}
+
+// timeOf returns the time of `ref` if it is the last block read
+func (l *lastReadBlock) timeOf(ref bstream.BlockRef) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.id == "" || l.id != ref.ID() {
+		return time.Time{}, false
+	}
+	return l.time, true
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/firehose/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func worstLiveLag(t *testing.T) time.Duration {
+	t.Helper()
+
+	out := &dto.Metric{}
+	require.NoError(t, metrics.LiveStreamWorstLag.Native().Write(out))
+	return time.Duration(out.Gauge.GetValue() * float64(time.Second))
+}
+
+func TestObserveLiveBlock(t *testing.T) {
+	streams := newActiveStreams()
+
+	behindCtx, behindDone := streams.track(context.Background(), StreamInfo{})
+	liveCtx, liveDone := streams.track(context.Background(), StreamInfo{})
+	_, historicalDone := streams.track(context.Background(), StreamInfo{})
+	defer historicalDone()
+
+	latencies := sampleCount(t, metrics.LiveStreamLatency.Native())
+
+	observeLiveBlock(liveCtx, time.Now().Add(-2*time.Second))
+	observeLiveBlock(behindCtx, time.Now().Add(-time.Minute))
+	assert.Equal(t, latencies+2, sampleCount(t, metrics.LiveStreamLatency.Native()))
+
+	streams.reportWorstLiveLag()
+	lag := worstLiveLag(t)
+	assert.GreaterOrEqual(t, lag, time.Minute)
+	assert.Less(t, lag, 2*time.Minute)
+
+	behindDone()
+	streams.reportWorstLiveLag()
+	lag = worstLiveLag(t)
+	assert.GreaterOrEqual(t, lag, 2*time.Second)
+	assert.Less(t, lag, time.Minute, "the stream behind is not active anymore")
+
+	liveDone()
+	streams.reportWorstLiveLag()
+	assert.Equal(t, time.Duration(0), worstLiveLag(t), "no live stream left")
+
+	observeLiveBlock(context.Background(), time.Now())
+	assert.Equal(t, latencies+3, sampleCount(t, metrics.LiveStreamLatency.Native()), "untracked streams are still measured")
+}
+
+func TestLiveLagReporter(t *testing.T) {
+	streams := newActiveStreams()
+	stuckCtx, stuckDone := streams.track(context.Background(), StreamInfo{})
+	defer stuckDone()
+
+	observeLiveBlock(stuckCtx, time.Now())
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go streams.runLiveLagReporter(time.Millisecond, stop)
+
+	// no block is sent anymore, the lag of the stuck stream still grows
+	require.Eventually(t, func() bool { return worstLiveLag(t) >= 50*time.Millisecond }, time.Second, time.Millisecond)
+}
+
+func TestLastReadBlock(t *testing.T) {
+	lastRead := &lastReadBlock{}
+	_, ok := lastRead.timeOf(bstream.NewBlockRef("00000002a", 2))
+	assert.False(t, ok)
+
+	blk := bstream.TestBlockWithTimestamp("00000002a", "00000001a", time.Unix(1700000000, 0))
+	lastRead.set(blk)
+
+	blockTime, ok := lastRead.timeOf(bstream.NewBlockRef("00000002a", 2))
+	require.True(t, ok)
+	assert.True(t, blockTime.Equal(time.Unix(1700000000, 0)))
+
+	_, ok = lastRead.timeOf(bstream.NewBlockRef("00000003a", 3))
+	assert.False(t, ok, "only the last block read is known")
+}
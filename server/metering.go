@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/streamingfast/dauth"
+	"github.com/streamingfast/dmetering"
+	"github.com/streamingfast/firehose"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// Endpoints under which the `dmetering` events of each serving path are emitted
+const (
+	MeteringEndpointBlocks            = "sf.firehose.v2.Firehose/Blocks"
+	MeteringEndpointBlocksPassthrough = "sf.firehose.v2.Firehose/Blocks:passthrough"
+	MeteringEndpointBlocksV1          = "sf.firehose.v1.Firehose/Blocks"
+	MeteringEndpointBlock             = "sf.firehose.v2.Firehose/Block"
+)
+
+// MeteringEndpoint returns the endpoint the request of `ctx` is metered under, for hooks
+// emitting their own events.
+func MeteringEndpoint(ctx context.Context) string {
+	if endpoint := getRequestMeter(ctx).endpoint.Load(); endpoint != "" {
+		return endpoint
+	}
+	return MeteringEndpointBlocks
+}
+
+func withMeteringEndpoint(ctx context.Context, endpoint string) context.Context {
+	ctx = withRequestMeter(ctx)
+	getRequestMeter(ctx).endpoint.Store(endpoint)
+	return ctx
+}
+
+// MeteringAggregation groups the blocks of a stream in a single `dmetering` event. An
+// event is emitted once Blocks blocks were sent or Interval elapsed since the previous
+// event, whichever comes first, and at the end of the stream for what remains. The
+// zero value emits one event per block. Both are only checked when a block is sent: a
+// stream stalled for longer than Interval emits its next event with its next block, or
+// when it ends.
+type MeteringAggregation struct {
+	Blocks   uint64
+	Interval time.Duration
+}
+
+func WithMeteringAggregation(aggregation MeteringAggregation) Option {
+	return func(s *Server) {
+		s.meteringAggregation = aggregation
+	}
+}
+
+var meteringAggregatorKey = key(1)
+
+// meteringHooks are the default hooks emitting the `dmetering` events of `Blocks`
+type meteringHooks struct {
+	aggregation MeteringAggregation
+	emit        func(context.Context, dmetering.Event)
+}
+
+func (m *meteringHooks) requestStart(ctx context.Context, _ *pbfirehose.Request, _ dauth.TrustedHeaders) context.Context {
+	ctx = dmetering.WithBytesMeter(ctx)
+	ctx = firehose.WithReadMeter(ctx)
+	return context.WithValue(ctx, meteringAggregatorKey, &meteringAggregator{lastEmit: time.Now()})
+}
+
+func (m *meteringHooks) response(ctx context.Context, _ *pbfirehose.Request, auth dauth.TrustedHeaders, response *pbfirehose.Response) {
+	aggregator, ok := ctx.Value(meteringAggregatorKey).(*meteringAggregator)
+	if !ok {
+		return
+	}
+
+	// like quotas and the stream summary, responses without a step, the boundaries of
+	// multi-range segments, are not blocks
+	if response.Step != pbfirehose.ForkStep_STEP_UNSET || MeteringEndpoint(ctx) == MeteringEndpointBlock {
+		aggregator.blocks++
+	}
+	aggregator.egressBytes += uint64(proto.Size(response))
+
+	if aggregator.due(m.aggregation) {
+		m.flush(ctx, auth, aggregator)
+	}
+}
+
+// requestEnd emits what remains since the last event, bytes read or written after the
+// last block sent included, like the read ahead of blocks that were filtered out.
+func (m *meteringHooks) requestEnd(ctx context.Context, _ *pbfirehose.Request, auth dauth.TrustedHeaders, _ error) {
+	if aggregator, ok := ctx.Value(meteringAggregatorKey).(*meteringAggregator); ok {
+		m.flush(ctx, auth, aggregator)
+	}
+}
+
+// flush emits the event of what was accumulated since the last one, if anything
+func (m *meteringHooks) flush(ctx context.Context, auth dauth.TrustedHeaders, aggregator *meteringAggregator) {
+	meter := dmetering.GetBytesMeter(ctx)
+
+	metrics := withReadMetrics(ctx, map[string]float64{
+		"egress_bytes":  float64(aggregator.egressBytes),
+		"written_bytes": float64(meter.BytesWrittenDelta()),
+		"read_bytes":    float64(meter.BytesReadDelta()),
+		"block_count":   float64(aggregator.blocks),
+	})
+
+	aggregator.blocks = 0
+	aggregator.egressBytes = 0
+	aggregator.lastEmit = time.Now()
+
+	if !hasNonZeroMetric(metrics) {
+		return
+	}
+
+	m.emit(ctx, dmetering.Event{
+		UserID:    auth.UserID(),
+		ApiKeyID:  auth.APIKeyID(),
+		IpAddress: auth.RealIP(),
+		Meta:      auth.Meta(),
+		Endpoint:  MeteringEndpoint(ctx),
+		Metrics:   metrics,
+		Timestamp: time.Now(),
+	})
+}
+
+func hasNonZeroMetric(metrics map[string]float64) bool {
+	for _, value := range metrics {
+		if value != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// withReadMetrics adds the wire and decompressed bytes read per block source since the
+// previous event to `metrics`
+func withReadMetrics(ctx context.Context, metrics map[string]float64) map[string]float64 {
+	wire, decompressed := firehose.GetReadMeter(ctx).Deltas()
+	for source, n := range wire {
+		metrics["read_bytes_"+string(source)] = float64(n)
+	}
+	for source, n := range decompressed {
+		metrics["decompressed_bytes_"+string(source)] = float64(n)
+	}
+	return metrics
+}
+
+// meteringAggregator holds what was sent on a stream since its last event
+type meteringAggregator struct {
+	blocks      uint64
+	egressBytes uint64
+	lastEmit    time.Time
+}
+
+func (a *meteringAggregator) due(aggregation MeteringAggregation) bool {
+	if aggregation.Blocks == 0 && aggregation.Interval == 0 {
+		return true
+	}
+	if aggregation.Blocks > 0 && a.blocks >= aggregation.Blocks {
+		return true
+	}
+	return aggregation.Interval > 0 && time.Since(a.lastEmit) >= aggregation.Interval
+}
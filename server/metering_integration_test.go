@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/bstream/transform"
+	"github.com/streamingfast/dauth"
+	"github.com/streamingfast/dmetering"
+	"github.com/streamingfast/dstore"
+	"github.com/streamingfast/firehose"
+	pbfirehoseV1 "github.com/streamingfast/pbgo/sf/firehose/v1"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type collectingEmitter struct {
+	mu     sync.Mutex
+	events []dmetering.Event
+}
+
+func (e *collectingEmitter) Emit(_ context.Context, event dmetering.Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, event)
+}
+
+func (e *collectingEmitter) Shutdown(error) {}
+
+// testServerStream is a server stream collecting what is sent to the client
+type testServerStream struct {
+	ctx  context.Context
+	sent int
+}
+
+func (s *testServerStream) SetHeader(metadata.MD) error  { return nil }
+func (s *testServerStream) SendHeader(metadata.MD) error { return nil }
+func (s *testServerStream) SetTrailer(metadata.MD)       {}
+func (s *testServerStream) Context() context.Context     { return s.ctx }
+func (s *testServerStream) SendMsg(interface{}) error    { return nil }
+func (s *testServerStream) RecvMsg(interface{}) error    { return nil }
+
+type testBlocksServer struct{ *testServerStream }
+
+func (s testBlocksServer) Send(*pbfirehose.Response) error {
+	s.sent++
+	return nil
+}
+
+// collectingBlocksServer keeps the responses sent to the client
+type collectingBlocksServer struct {
+	testServerStream
+
+	mu        sync.Mutex
+	responses []*pbfirehose.Response
+}
+
+func newCollectingBlocksServer(ctx context.Context) *collectingBlocksServer {
+	return &collectingBlocksServer{testServerStream: testServerStream{ctx: ctx}}
+}
+
+func (s *collectingBlocksServer) Send(resp *pbfirehose.Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses = append(s.responses, resp)
+	return nil
+}
+
+func (s *collectingBlocksServer) sent() []*pbfirehose.Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*pbfirehose.Response(nil), s.responses...)
+}
+
+type testBlocksServerV1 struct{ *testServerStream }
+
+func (s testBlocksServerV1) Send(*pbfirehoseV1.Response) error {
+	s.sent++
+	return nil
+}
+
+// testPassthrough outputs one message per block of the stream it runs
+type testPassthrough struct{}
+
+func (testPassthrough) String() string { return "test passthrough" }
+
+func (testPassthrough) Run(ctx context.Context, req *pbfirehose.Request, getStream transform.StreamGetter, output transform.StreamOutput) error {
+	str, err := getStream(ctx, bstream.HandlerFunc(func(blk *bstream.Block, obj interface{}) error {
+		message, err := anypb.New(wrapperspb.String("passthrough " + blk.Id))
+		if err != nil {
+			return err
+		}
+		return output(obj.(bstream.Cursorable).Cursor(), message)
+	}), req, true, zap.NewNop())
+	if err != nil {
+		return err
+	}
+	return str.Run(ctx)
+}
+
+func newMeteringTestServer(t *testing.T) (*Server, *collectingEmitter) {
+	t.Helper()
+
+	mergedStore := dstore.NewMockStore(nil)
+	mergedStore.SetFile("0000000000", []byte(strings.Join([]string{
+		bstream.TestJSONBlockWithLIBNum("00000002a", "00000001a", 1),
+		bstream.TestJSONBlockWithLIBNum("00000003a", "00000002a", 2),
+		bstream.TestJSONBlockWithLIBNum("00000004a", "00000003a", 3),
+		bstream.TestJSONBlockWithLIBNum("00000005a", "00000004a", 4),
+	}, "\n")))
+
+	registry := transform.NewRegistry()
+	registry.Register(&transform.Factory{
+		Obj: &wrapperspb.StringValue{},
+		NewFunc: func(*anypb.Any) (transform.Transform, error) {
+			return testPassthrough{}, nil
+		},
+	})
+
+	emitter := &collectingEmitter{}
+	dmetering.SetDefaultEmitter(emitter)
+
+	s := &Server{
+		streamFactory:     firehose.NewStreamFactory(mergedStore, nil, nil, registry),
+		transformRegistry: registry,
+		blockGetter:       firehose.NewBlockGetter(mergedStore, nil, nil),
+		logger:            zap.NewNop(),
+		streams:           newActiveStreams(),
+	}
+	s.installDefaultHooks()
+
+	return s, emitter
+}
+
+func TestMeteringEndpoints(t *testing.T) {
+	passthroughTransform, err := anypb.New(wrapperspb.String("config"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name             string
+		serve            func(ctx context.Context, s *Server) error
+		expectedEndpoint string
+		expectedBlocks   float64
+		expectedSource   firehose.BlockSource
+	}{
+		{
+			"blocks",
+			func(ctx context.Context, s *Server) error {
+				return s.Blocks(&pbfirehose.Request{StartBlockNum: 2, StopBlockNum: 4}, testBlocksServer{&testServerStream{ctx: ctx}})
+			},
+			MeteringEndpointBlocks,
+			3,
+			firehose.BlockSourceMergedBlocks,
+		},
+		{
+			"blocks passthrough",
+			func(ctx context.Context, s *Server) error {
+				return s.Blocks(&pbfirehose.Request{StartBlockNum: 2, StopBlockNum: 4, Transforms: []*anypb.Any{passthroughTransform}}, testBlocksServer{&testServerStream{ctx: ctx}})
+			},
+			MeteringEndpointBlocksPassthrough,
+			3,
+			firehose.BlockSourceMergedBlocks,
+		},
+		{
+			"blocks v1",
+			func(ctx context.Context, s *Server) error {
+				return NewFirehoseProxyV1ToV2(s).Blocks(&pbfirehoseV1.Request{
+					StartBlockNum: 2,
+					StopBlockNum:  4,
+					ForkSteps:     []pbfirehoseV1.ForkStep{pbfirehoseV1.ForkStep_STEP_NEW},
+				}, testBlocksServerV1{&testServerStream{ctx: ctx}})
+			},
+			MeteringEndpointBlocksV1,
+			3,
+			firehose.BlockSourceMergedBlocks,
+		},
+		{
+			"block",
+			func(ctx context.Context, s *Server) error {
+				_, err := s.Block(ctx, &pbfirehose.SingleBlockRequest{
+					Reference: &pbfirehose.SingleBlockRequest_BlockNumber_{BlockNumber: &pbfirehose.SingleBlockRequest_BlockNumber{Num: 3}},
+				})
+				return err
+			},
+			MeteringEndpointBlock,
+			1,
+			firehose.BlockSourceMergedBlocks,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, emitter := newMeteringTestServer(t)
+			ctx := dauth.WithTrustedHeaders(context.Background(), dauth.TrustedHeaders{
+				dauth.SFHeaderUserID:   "user",
+				dauth.SFHeaderApiKeyID: "key",
+			})
+
+			require.NoError(t, test.serve(ctx, s))
+
+			require.NotEmpty(t, emitter.events)
+			totals := meteringTotals(emitter.events)
+			assert.Equal(t, test.expectedBlocks, totals["block_count"])
+			assert.Greater(t, totals["egress_bytes"], float64(0))
+			assert.Greater(t, totals["decompressed_bytes_"+string(test.expectedSource)], float64(0))
+			for i, event := range emitter.events {
+				assert.Equal(t, test.expectedEndpoint, event.Endpoint, fmt.Sprintf("event %d", i))
+				assert.Equal(t, "user", event.UserID)
+				assert.Equal(t, "key", event.ApiKeyID)
+			}
+		})
+	}
+}
+
+func TestMeteringDisabled(t *testing.T) {
+	s, emitter := newMeteringTestServer(t)
+	s.requestStartHooks, s.responseHooks, s.requestEndHooks, s.metering = nil, nil, nil, nil
+
+	_, err := s.Block(context.Background(), &pbfirehose.SingleBlockRequest{
+		Reference: &pbfirehose.SingleBlockRequest_BlockNumber_{BlockNumber: &pbfirehose.SingleBlockRequest_BlockNumber{Num: 3}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.Blocks(&pbfirehose.Request{StartBlockNum: 2, StopBlockNum: 4}, testBlocksServer{&testServerStream{ctx: context.Background()}}))
+
+	assert.Empty(t, emitter.events)
+}
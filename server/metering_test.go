@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dauth"
+	"github.com/streamingfast/dmetering"
+	"github.com/streamingfast/firehose"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// meterStream runs the metering hooks over a stream of `blocks` responses of varying
+// sizes and returns the emitted events
+func meterStream(t *testing.T, aggregation MeteringAggregation, blocks int) []dmetering.Event {
+	t.Helper()
+
+	var events []dmetering.Event
+	hooks := &meteringHooks{aggregation: aggregation, emit: func(_ context.Context, event dmetering.Event) {
+		events = append(events, event)
+	}}
+
+	auth := dauth.TrustedHeaders{dauth.SFHeaderUserID: "user"}
+	request := &pbfirehose.Request{}
+	ctx := hooks.requestStart(dauth.WithTrustedHeaders(context.Background(), auth), request, auth)
+
+	for i := 0; i < blocks; i++ {
+		dmetering.GetBytesMeter(ctx).AddBytesRead(100 + i)
+		dmetering.GetBytesMeter(ctx).AddBytesWritten(i % 3)
+		hooks.response(ctx, request, auth, &pbfirehose.Response{
+			Step:   pbfirehose.ForkStep_STEP_NEW,
+			Cursor: string(make([]byte, i%17)),
+			Block:  &anypb.Any{Value: make([]byte, i*13)},
+		})
+	}
+	hooks.requestEnd(ctx, request, auth, nil)
+
+	return events
+}
+
+func meteringTotals(events []dmetering.Event) map[string]float64 {
+	out := map[string]float64{}
+	for _, event := range events {
+		for name, value := range event.Metrics {
+			out[name] += value
+		}
+	}
+	return out
+}
+
+func TestMeteringAggregationTotals(t *testing.T) {
+	perBlock := meterStream(t, MeteringAggregation{}, 103)
+	assert.Len(t, perBlock, 103)
+
+	tests := []struct {
+		name           string
+		aggregation    MeteringAggregation
+		expectedEvents int
+	}{
+		{"by blocks", MeteringAggregation{Blocks: 10}, 11},
+		{"by blocks, exact multiple", MeteringAggregation{Blocks: 103}, 1},
+		{"more blocks than sent", MeteringAggregation{Blocks: 1000}, 1},
+		{"by long interval", MeteringAggregation{Interval: time.Hour}, 1},
+		{"by blocks or long interval", MeteringAggregation{Blocks: 50, Interval: time.Hour}, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			aggregated := meterStream(t, test.aggregation, 103)
+
+			assert.Len(t, aggregated, test.expectedEvents)
+			assert.Equal(t, meteringTotals(perBlock), meteringTotals(aggregated))
+			for _, event := range aggregated {
+				assert.Equal(t, "user", event.UserID)
+				assert.Equal(t, "sf.firehose.v2.Firehose/Blocks", event.Endpoint)
+			}
+		})
+	}
+}
+
+func TestMeteringAggregatorDue(t *testing.T) {
+	aggregator := &meteringAggregator{blocks: 3, lastEmit: time.Now().Add(-2 * time.Second)}
+
+	assert.True(t, aggregator.due(MeteringAggregation{}))
+	assert.True(t, aggregator.due(MeteringAggregation{Blocks: 3}))
+	assert.False(t, aggregator.due(MeteringAggregation{Blocks: 4}))
+	assert.True(t, aggregator.due(MeteringAggregation{Blocks: 4, Interval: time.Second}))
+	assert.False(t, aggregator.due(MeteringAggregation{Interval: time.Minute}))
+}
+
+func TestMeteringNoEventWithoutBlocks(t *testing.T) {
+	assert.Empty(t, meterStream(t, MeteringAggregation{Blocks: 10}, 0))
+}
+
+func TestMeteringTrailingReads(t *testing.T) {
+	for _, aggregation := range []MeteringAggregation{{}, {Blocks: 10}} {
+		var events []dmetering.Event
+		hooks := &meteringHooks{aggregation: aggregation, emit: func(_ context.Context, event dmetering.Event) {
+			events = append(events, event)
+		}}
+
+		auth := dauth.TrustedHeaders{dauth.SFHeaderUserID: "user"}
+		request := &pbfirehose.Request{}
+		ctx := hooks.requestStart(context.Background(), request, auth)
+
+		for i := 0; i < 10; i++ {
+			dmetering.GetBytesMeter(ctx).AddBytesRead(100)
+			hooks.response(ctx, request, auth, &pbfirehose.Response{Step: pbfirehose.ForkStep_STEP_NEW})
+		}
+
+		// blocks read and filtered out after the last block sent
+		dmetering.GetBytesMeter(ctx).AddBytesRead(50)
+		dmetering.GetBytesMeter(ctx).AddBytesWritten(5)
+		firehose.GetReadMeter(ctx).AddDecompressed(firehose.BlockSourceMergedBlocks, 200)
+		hooks.requestEnd(ctx, request, auth, nil)
+
+		totals := meteringTotals(events)
+		assert.Equal(t, float64(10), totals["block_count"])
+		assert.Equal(t, float64(1050), totals["read_bytes"])
+		assert.Equal(t, float64(5), totals["written_bytes"])
+		assert.Equal(t, float64(200), totals["decompressed_bytes_merged_blocks"])
+	}
+}
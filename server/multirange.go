@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/streamingfast/firehose"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// BlockRangesHeader is the request metadata key used by clients to stream an
+// ordered list of block ranges back-to-back over a single `Blocks` stream. The
+// value is a comma separated list of inclusive `<start>-<stop>` ranges, for
+// example `100-199,5000-5099`. When set, the request `StartBlockNum` and
+// `StopBlockNum` must be left empty.
+//
+// Each segment is preceded and followed by a boundary marker: a STEP_UNSET
+// response whose `Block` is a `google.protobuf.Struct` holding the `segment`
+// index, its `start_block`, `stop_block` and the `boundary` kind (`start` or
+// `end`). Cursors returned in this mode encode the segment they belong to and
+// must be sent back along with the same ranges to resume. The cursor of an `end`
+// boundary resumes at the start of the next segment, the one ending the last
+// segment resumes a request already complete, which ends without streaming anything.
+const BlockRangesHeader = "x-firehose-block-ranges"
+
+type blockRange struct {
+	start uint64
+	stop  uint64
+}
+
+func (r blockRange) String() string {
+	return fmt.Sprintf("%d-%d", r.start, r.stop)
+}
+
+func blockRangesFromContext(ctx context.Context) ([]blockRange, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+	values := md.Get(BlockRangesHeader)
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	return parseBlockRanges(strings.Join(values, ","))
+}
+
+func parseBlockRanges(in string) (out []blockRange, err error) {
+	for _, part := range strings.Split(in, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		bounds := strings.SplitN(part, "-", 2)
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("invalid block range %q: expecting <start>-<stop>", part)
+		}
+
+		start, err := strconv.ParseUint(strings.TrimSpace(bounds[0]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block range %q: start: %w", part, err)
+		}
+		stop, err := strconv.ParseUint(strings.TrimSpace(bounds[1]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block range %q: stop: %w", part, err)
+		}
+
+		if stop < start {
+			return nil, fmt.Errorf("invalid block range %q: stop block is before start block", part)
+		}
+		if len(out) > 0 && start <= out[len(out)-1].stop {
+			return nil, fmt.Errorf("invalid block range %q: ranges must be ordered and not overlap", part)
+		}
+
+		out = append(out, blockRange{start: start, stop: stop})
+	}
+
+	if len(out) == 0 {
+		return nil, fmt.Errorf("invalid block ranges %q: no range specified", in)
+	}
+
+	return out, nil
+}
+
+// segmentStream wraps the client stream to encode the segment index within
+// every cursor sent out.
+type segmentStream struct {
+	pbfirehose.Stream_BlocksServer
+	segment int
+}
+
+func (s *segmentStream) Send(resp *pbfirehose.Response) error {
+	resp.Cursor = firehose.EncodeSegmentCursor(s.segment, resp.Cursor)
+	return s.Stream_BlocksServer.Send(resp)
+}
+
+func (s *Server) multiRangeBlocks(ctx context.Context, request *pbfirehose.Request, ranges []blockRange, streamSrv pbfirehose.Stream_BlocksServer, logger *zap.Logger) error {
+	if request.StartBlockNum != 0 || request.StopBlockNum != 0 {
+		return status.Errorf(codes.InvalidArgument, "start and stop block must not be set when using %q", BlockRangesHeader)
+	}
+
+	firstSegment := 0
+	var resumeCursor string
+	if request.Cursor != "" {
+		segment, cursor, err := firehose.DecodeSegmentCursor(request.Cursor)
+		if err != nil {
+			return firehose.NewErrInvalidCursor(request.Cursor, err)
+		}
+		// segment len(ranges) is the end boundary of the last range, nothing is left
+		if segment < 0 || segment > len(ranges) {
+			return firehose.NewErrInvalidCursor(request.Cursor, fmt.Errorf("segment %d out of the %d requested ranges", segment, len(ranges)))
+		}
+		firstSegment = segment
+		resumeCursor = cursor
+	}
+
+	logger.Info("processing multi-range blocks request", zap.Int("segment_count", len(ranges)), zap.Int("first_segment", firstSegment))
+
+	for i := firstSegment; i < len(ranges); i++ {
+		rng := ranges[i]
+		segmentRequest := &pbfirehose.Request{
+			StartBlockNum:   int64(rng.start),
+			StopBlockNum:    rng.stop,
+			FinalBlocksOnly: request.FinalBlocksOnly,
+			Transforms:      request.Transforms,
+		}
+
+		startCursor := firehose.EncodeSegmentCursor(i, "")
+		if i == firstSegment && resumeCursor != "" {
+			segmentRequest.Cursor = resumeCursor
+			startCursor = firehose.EncodeSegmentCursor(i, resumeCursor)
+		}
+
+		if err := sendSegmentBoundary(streamSrv, i, rng, "start", startCursor); err != nil {
+			return err
+		}
+
+		segmentLogger := logger.With(zap.Int("segment", i), zap.Stringer("range", rng))
+		if err := s.blocks(ctx, segmentRequest, &segmentStream{Stream_BlocksServer: streamSrv, segment: i}, segmentLogger); err != nil {
+			return err
+		}
+
+		if err := sendSegmentBoundary(streamSrv, i, rng, "end", firehose.EncodeSegmentCursor(i+1, "")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func sendSegmentBoundary(streamSrv pbfirehose.Stream_BlocksServer, segment int, rng blockRange, boundary string, cursor string) error {
+	payload, err := structpb.NewStruct(map[string]interface{}{
+		"segment":     float64(segment),
+		"start_block": float64(rng.start),
+		"stop_block":  float64(rng.stop),
+		"boundary":    boundary,
+	})
+	if err != nil {
+		return fmt.Errorf("building segment boundary: %w", err)
+	}
+
+	cnt, err := anypb.New(payload)
+	if err != nil {
+		return fmt.Errorf("to any: %w", err)
+	}
+
+	if err := streamSrv.Send(&pbfirehose.Response{
+		Step:   pbfirehose.ForkStep_STEP_UNSET,
+		Cursor: cursor,
+		Block:  cnt,
+	}); err != nil {
+		return NewErrSendBlock(err).GRPCStatus().Err()
+	}
+
+	return nil
+}
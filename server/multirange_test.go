@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/streamingfast/firehose"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestParseBlockRanges(t *testing.T) {
+	tests := []struct {
+		name          string
+		in            string
+		expected      []blockRange
+		expectedError string
+	}{
+		{"single", "10-20", []blockRange{{10, 20}}, ""},
+		{"multiple", "10-20, 30-30,40-50", []blockRange{{10, 20}, {30, 30}, {40, 50}}, ""},
+		{"empty parts", "10-20,,", []blockRange{{10, 20}}, ""},
+		{"empty", "", nil, "no range specified"},
+		{"missing stop", "10", nil, "expecting <start>-<stop>"},
+		{"invalid start", "a-10", nil, "start"},
+		{"invalid stop", "10-b", nil, "stop"},
+		{"negative", "-5-10", nil, "start"},
+		{"stop before start", "20-10", nil, "stop block is before start block"},
+		{"overlapping", "10-20,20-30", nil, "ordered and not overlap"},
+		{"unordered", "30-40,10-20", nil, "ordered and not overlap"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ranges, err := parseBlockRanges(test.in)
+			if test.expectedError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, ranges)
+		})
+	}
+}
+
+func TestMultiRangePassthrough(t *testing.T) {
+	passthroughTransform, err := anypb.New(wrapperspb.String("config"))
+	require.NoError(t, err)
+
+	s, _ := newMeteringTestServer(t)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(BlockRangesHeader, "2-3,4-5"))
+
+	srv := newCollectingBlocksServer(ctx)
+	require.NoError(t, s.Blocks(&pbfirehose.Request{Transforms: []*anypb.Any{passthroughTransform}}, srv))
+
+	var received []string
+	var resumeCursor string
+	for _, resp := range srv.sent() {
+		segment, _, err := firehose.DecodeSegmentCursor(resp.Cursor)
+		require.NoError(t, err)
+
+		if resp.Step == pbfirehose.ForkStep_STEP_UNSET {
+			boundary := &structpb.Struct{}
+			require.NoError(t, resp.Block.UnmarshalTo(boundary))
+			received = append(received, boundary.Fields["boundary"].GetStringValue())
+			continue
+		}
+
+		message := &wrapperspb.StringValue{}
+		require.NoError(t, resp.Block.UnmarshalTo(message))
+		received = append(received, message.Value)
+		if message.Value == "passthrough 00000002a" {
+			assert.Equal(t, 0, segment)
+			resumeCursor = resp.Cursor
+		}
+	}
+
+	assert.Equal(t, []string{
+		"start", "passthrough 00000002a", "passthrough 00000003a", "end",
+		"start", "passthrough 00000004a", "passthrough 00000005a", "end",
+	}, received)
+
+	t.Run("resume", func(t *testing.T) {
+		srv := newCollectingBlocksServer(ctx)
+		require.NoError(t, s.Blocks(&pbfirehose.Request{Cursor: resumeCursor, Transforms: []*anypb.Any{passthroughTransform}}, srv))
+		assert.Len(t, srv.sent(), 7) // resumes at block 3 of the first segment
+	})
+
+	t.Run("resume from end boundary", func(t *testing.T) {
+		endCursor := srv.sent()[3].Cursor
+		info, err := firehose.DecodeCursor(endCursor)
+		require.NoError(t, err)
+		assert.True(t, info.SegmentBoundary)
+
+		resumed := newCollectingBlocksServer(ctx)
+		require.NoError(t, s.Blocks(&pbfirehose.Request{Cursor: endCursor, Transforms: []*anypb.Any{passthroughTransform}}, resumed))
+		assert.Len(t, resumed.sent(), 4) // the whole second segment
+	})
+
+	t.Run("resume completed", func(t *testing.T) {
+		sent := srv.sent()
+		resumed := newCollectingBlocksServer(ctx)
+		require.NoError(t, s.Blocks(&pbfirehose.Request{Cursor: sent[len(sent)-1].Cursor, Transforms: []*anypb.Any{passthroughTransform}}, resumed))
+		assert.Empty(t, resumed.sent())
+	})
+}
+
+func TestMultiRangeRejectedCombinations(t *testing.T) {
+	s, _ := newMeteringTestServer(t)
+	rangesCtx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(BlockRangesHeader, "2-3"))
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		request *pbfirehose.Request
+	}{
+		{
+			"start anchor",
+			metadata.NewIncomingContext(context.Background(), metadata.Pairs(BlockRangesHeader, "2-3", StartAnchorHeader, "head")),
+			&pbfirehose.Request{},
+		},
+		{"start block", rangesCtx, &pbfirehose.Request{StartBlockNum: 2}},
+		{
+			"segment cursor without ranges",
+			context.Background(),
+			&pbfirehose.Request{StartBlockNum: 2, Cursor: firehose.EncodeSegmentCursor(1, "")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := s.Blocks(test.request, newCollectingBlocksServer(test.ctx))
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/streamingfast/dauth"
+	"github.com/streamingfast/firehose"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+)
+
+// RequestPolicy caps what a single `Blocks` request can consume. Zero values disable
+// the corresponding limit.
+type RequestPolicy struct {
+	// MaxBlockRange is the maximum number of blocks between the start and the stop block
+	// of a request, summed over all the ranges of multi-range requests. Unbounded
+	// requests are rejected when set.
+	MaxBlockRange uint64
+
+	// MaxDuration is the maximum wall-clock duration of a stream.
+	MaxDuration time.Duration
+
+	// MaxBlocks is the maximum number of blocks sent on a single stream.
+	MaxBlocks uint64
+
+	// FinalBlocksOnly rejects requests for live, non-final, blocks.
+	FinalBlocksOnly bool
+}
+
+// RequestPolicies selects the RequestPolicy of each request from the tier found in the
+// trusted authentication headers under TierHeader. Callers without a tier, or with a
+// tier not listed in Tiers, get the Default policy.
+type RequestPolicies struct {
+	TierHeader string
+	Tiers      map[string]RequestPolicy
+	Default    RequestPolicy
+}
+
+func WithRequestPolicies(policies RequestPolicies) Option {
+	return func(s *Server) {
+		s.requestPolicies = &policies
+	}
+}
+
+// requestPolicy returns the tier of the caller and its policy
+func (s *Server) requestPolicy(ctx context.Context) (string, RequestPolicy) {
+	var tier string
+	if auth := dauth.FromContext(ctx); auth != nil && s.requestPolicies.TierHeader != "" {
+		tier = auth.Get(s.requestPolicies.TierHeader)
+	}
+
+	if policy, found := s.requestPolicies.Tiers[tier]; found {
+		return tier, policy
+	}
+	if tier == "" {
+		tier = "default"
+	}
+	return tier, s.requestPolicies.Default
+}
+
+// checkRequestPolicy validates the request against the policy before anything is
+// streamed. The block range of a resumed request only counts the blocks left to stream.
+func (s *Server) checkRequestPolicy(tier string, policy RequestPolicy, request *pbfirehose.Request, ranges []blockRange, descending bool) error {
+	if policy.FinalBlocksOnly && !request.FinalBlocksOnly {
+		return firehose.NewErrPolicyViolation(tier, "final_blocks_only", "only final blocks can be streamed, set final_blocks_only")
+	}
+
+	if policy.MaxBlockRange == 0 {
+		return nil
+	}
+
+	var blockRange uint64
+	if ranges != nil {
+		for _, rng := range ranges {
+			blockRange += rng.stop - rng.start + 1
+		}
+	} else {
+		if request.StopBlockNum == 0 {
+			return firehose.NewErrPolicyViolation(tier, "max_block_range", fmt.Sprintf("unbounded requests are not allowed, a stop block at most %d blocks after the start block is required", policy.MaxBlockRange))
+		}
+
+		firstBlockNum, ok := s.resolvedStartBlock(request, descending)
+		if !ok {
+			return firehose.NewErrPolicyViolation(tier, "max_block_range", "cannot determine the start block of the request")
+		}
+
+		// descending requests stream from their first block down to their start block
+		lowBlockNum, highBlockNum := firstBlockNum, request.StopBlockNum
+		if descending {
+			lowBlockNum, highBlockNum = 0, firstBlockNum
+			if request.StartBlockNum > 0 {
+				lowBlockNum = uint64(request.StartBlockNum)
+			}
+		}
+		if highBlockNum >= lowBlockNum {
+			blockRange = highBlockNum - lowBlockNum + 1
+		}
+	}
+
+	if blockRange > policy.MaxBlockRange {
+		return firehose.NewErrPolicyViolation(tier, "max_block_range", fmt.Sprintf("requested %d blocks, at most %d are allowed", blockRange, policy.MaxBlockRange))
+	}
+	return nil
+}
+
+// policyStream enforces the limits of a policy while the request is streamed, exceeded
+// holds the error to return once the stream terminated because of them.
+type policyStream struct {
+	pbfirehose.Stream_BlocksServer
+
+	tier     string
+	policy   RequestPolicy
+	blocks   uint64
+	exceeded error
+}
+
+func (p *policyStream) Send(resp *pbfirehose.Response) error {
+	if p.exceeded != nil {
+		return p.exceeded
+	}
+
+	if resp.Step != pbfirehose.ForkStep_STEP_UNSET && p.policy.MaxBlocks > 0 && p.blocks >= p.policy.MaxBlocks {
+		p.exceeded = firehose.NewErrPolicyLimitReached(p.tier, "max_blocks", fmt.Sprintf("at most %d blocks can be sent on a single stream", p.policy.MaxBlocks))
+		return p.exceeded
+	}
+
+	if err := p.Stream_BlocksServer.Send(resp); err != nil {
+		return err
+	}
+
+	if resp.Step != pbfirehose.ForkStep_STEP_UNSET {
+		p.blocks++
+	}
+	return nil
+}
+
+// withDeadline bounds the stream context to the policy maximum duration
+func (p *policyStream) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.policy.MaxDuration == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, p.policy.MaxDuration)
+}
+
+// terminationError returns the error to send to the client when the stream was
+// terminated by the policy, nil otherwise.
+func (p *policyStream) terminationError(streamCtx context.Context) error {
+	if p.exceeded != nil {
+		return p.exceeded
+	}
+	if p.policy.MaxDuration > 0 && streamCtx.Err() == context.DeadlineExceeded {
+		return firehose.NewErrPolicyLimitReached(p.tier, "max_duration", fmt.Sprintf("streams can last at most %s", p.policy.MaxDuration))
+	}
+	return nil
+}
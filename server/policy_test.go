@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/dauth"
+	"github.com/streamingfast/firehose"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCheckRequestPolicy(t *testing.T) {
+	s := &Server{streamFactory: firehose.NewStreamFactory(nil, nil, nil, nil)}
+
+	cursor := func(num uint64) string {
+		ref := bstream.NewBlockRef("0000000a", num)
+		return (&bstream.Cursor{Step: bstream.StepIrreversible, Block: ref, HeadBlock: ref, LIB: ref}).ToOpaque()
+	}
+
+	tests := []struct {
+		name         string
+		policy       RequestPolicy
+		request      *pbfirehose.Request
+		ranges       []blockRange
+		descending   bool
+		expectedCode codes.Code
+	}{
+		{"no limits", RequestPolicy{}, &pbfirehose.Request{StartBlockNum: 10}, nil, false, codes.OK},
+		{"within range", RequestPolicy{MaxBlockRange: 100}, &pbfirehose.Request{StartBlockNum: 10, StopBlockNum: 109}, nil, false, codes.OK},
+		{"range too large", RequestPolicy{MaxBlockRange: 100}, &pbfirehose.Request{StartBlockNum: 10, StopBlockNum: 110}, nil, false, codes.PermissionDenied},
+		{"unbounded", RequestPolicy{MaxBlockRange: 100}, &pbfirehose.Request{StartBlockNum: 10}, nil, false, codes.PermissionDenied},
+		{"multi-range within", RequestPolicy{MaxBlockRange: 100}, &pbfirehose.Request{}, []blockRange{{0, 49}, {100, 149}}, false, codes.OK},
+		{"multi-range too large", RequestPolicy{MaxBlockRange: 100}, &pbfirehose.Request{}, []blockRange{{0, 49}, {100, 150}}, false, codes.PermissionDenied},
+		{"final blocks required", RequestPolicy{FinalBlocksOnly: true}, &pbfirehose.Request{StartBlockNum: 10}, nil, false, codes.PermissionDenied},
+		{"final blocks requested", RequestPolicy{FinalBlocksOnly: true}, &pbfirehose.Request{StartBlockNum: 10, FinalBlocksOnly: true}, nil, false, codes.OK},
+		{"resumed within range", RequestPolicy{MaxBlockRange: 100}, &pbfirehose.Request{StartBlockNum: 10, StopBlockNum: 110, Cursor: cursor(10)}, nil, false, codes.OK},
+		{"resumed range too large", RequestPolicy{MaxBlockRange: 100}, &pbfirehose.Request{StartBlockNum: 10, StopBlockNum: 111, Cursor: cursor(10)}, nil, false, codes.PermissionDenied},
+		{"descending within range", RequestPolicy{MaxBlockRange: 100}, &pbfirehose.Request{StartBlockNum: 10, StopBlockNum: 109}, nil, true, codes.OK},
+		{"descending range too large", RequestPolicy{MaxBlockRange: 100}, &pbfirehose.Request{StartBlockNum: 10, StopBlockNum: 110}, nil, true, codes.PermissionDenied},
+		{"descending resumed within range", RequestPolicy{MaxBlockRange: 100}, &pbfirehose.Request{StartBlockNum: 10, StopBlockNum: 110, Cursor: firehose.EncodeDescendingCursor(cursor(110))}, nil, true, codes.OK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := s.checkRequestPolicy("free", test.policy, test.request, test.ranges, test.descending)
+			if test.expectedCode == codes.OK {
+				assert.NoError(t, err)
+				return
+			}
+
+			var errPolicyViolation *firehose.ErrPolicyViolation
+			require.ErrorAs(t, err, &errPolicyViolation)
+			assert.Equal(t, "free", errPolicyViolation.Tier)
+			assert.Equal(t, test.expectedCode, errPolicyViolation.GRPCStatus().Code())
+		})
+	}
+}
+
+func TestRequestPolicyTier(t *testing.T) {
+	s := &Server{requestPolicies: &RequestPolicies{
+		TierHeader: "x-sf-tier",
+		Tiers:      map[string]RequestPolicy{"free": {MaxBlocks: 10}},
+		Default:    RequestPolicy{MaxBlocks: 1},
+	}}
+
+	tier, policy := s.requestPolicy(context.Background())
+	assert.Equal(t, "default", tier)
+	assert.Equal(t, uint64(1), policy.MaxBlocks)
+}
+
+type sentCounterStream struct {
+	grpc.ServerStream
+	sent int
+}
+
+func (s *sentCounterStream) Send(*pbfirehose.Response) error {
+	s.sent++
+	return nil
+}
+
+func TestPolicyStreamMaxBlocks(t *testing.T) {
+	inner := &sentCounterStream{}
+	p := &policyStream{Stream_BlocksServer: inner, tier: "free", policy: RequestPolicy{MaxBlocks: 2}}
+
+	require.NoError(t, p.Send(&pbfirehose.Response{Step: pbfirehose.ForkStep_STEP_NEW}))
+	require.NoError(t, p.Send(&pbfirehose.Response{Step: pbfirehose.ForkStep_STEP_UNSET}), "segment boundaries are not counted")
+	require.NoError(t, p.Send(&pbfirehose.Response{Step: pbfirehose.ForkStep_STEP_NEW}))
+
+	err := p.Send(&pbfirehose.Response{Step: pbfirehose.ForkStep_STEP_NEW})
+	var errLimitReached *firehose.ErrPolicyLimitReached
+	require.ErrorAs(t, err, &errLimitReached)
+	assert.Equal(t, "max_blocks", errLimitReached.Limit)
+	assert.Equal(t, codes.ResourceExhausted, errLimitReached.GRPCStatus().Code())
+	assert.Equal(t, 3, inner.sent)
+
+	assert.Equal(t, err, p.terminationError(context.Background()))
+}
+
+func TestPolicyStreamMaxDuration(t *testing.T) {
+	p := &policyStream{tier: "free", policy: RequestPolicy{MaxDuration: 10 * time.Millisecond}}
+
+	ctx, cancel := p.withDeadline(context.Background())
+	defer cancel()
+	<-ctx.Done()
+
+	var errLimitReached *firehose.ErrPolicyLimitReached
+	require.ErrorAs(t, p.terminationError(ctx), &errLimitReached)
+	assert.Equal(t, "max_duration", errLimitReached.Limit)
+
+	canceledCtx, cancelNow := p.withDeadline(context.Background())
+	cancelNow()
+	assert.NoError(t, p.terminationError(canceledCtx))
+}
+
+func TestPolicyMaxBlocksMetering(t *testing.T) {
+	s, emitter := newMeteringTestServer(t)
+	s.requestPolicies = &RequestPolicies{Default: RequestPolicy{MaxBlocks: 2}}
+
+	var hooked int
+	s.responseHooks = append(s.responseHooks, func(context.Context, *pbfirehose.Request, dauth.TrustedHeaders, *pbfirehose.Response) {
+		hooked++
+	})
+
+	srv := newCollectingBlocksServer(context.Background())
+	err := s.Blocks(&pbfirehose.Request{StartBlockNum: 2, StopBlockNum: 4}, srv)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	assert.Len(t, srv.sent(), 2)
+	assert.Equal(t, 2, hooked, "the refused block is not seen by hooks")
+	assert.Equal(t, float64(2), meteringTotals(emitter.events)["block_count"], "the refused block is not metered")
+}
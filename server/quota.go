@@ -0,0 +1,94 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/streamingfast/dauth"
+	"github.com/streamingfast/firehose/quota"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// WithQuotas checks the usage quotas of callers when their requests are received and
+// while they are streamed.
+func WithQuotas(enforcer *quota.Enforcer) Option {
+	return func(s *Server) {
+		s.quotas = enforcer
+	}
+}
+
+// quotaStream accounts what is sent to the caller, checking its quotas every check
+// interval of the enforcer. exceeded holds the error to return once the stream
+// terminated because of them. It sits below the send buffer so a send it abandoned can
+// still complete once the stream terminated, the usage is guarded accordingly.
+type quotaStream struct {
+	pbfirehose.Stream_BlocksServer
+
+	enforcer *quota.Enforcer
+	auth     dauth.TrustedHeaders
+
+	mu        sync.Mutex
+	lastCheck time.Time
+	exceeded  error
+
+	pendingBlocks      uint64
+	pendingEgressBytes uint64
+}
+
+func newQuotaStream(enforcer *quota.Enforcer, auth dauth.TrustedHeaders) *quotaStream {
+	return &quotaStream{
+		enforcer:  enforcer,
+		auth:      auth,
+		lastCheck: time.Now(),
+	}
+}
+
+func (q *quotaStream) Send(resp *pbfirehose.Response) error {
+	if err := q.exceededError(); err != nil {
+		return err
+	}
+
+	if err := q.Stream_BlocksServer.Send(resp); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if resp.Step != pbfirehose.ForkStep_STEP_UNSET {
+		q.pendingBlocks++
+	}
+	q.pendingEgressBytes += uint64(proto.Size(resp))
+
+	if time.Since(q.lastCheck) < q.enforcer.CheckInterval() {
+		return nil
+	}
+	q.lastCheck = time.Now()
+	q.exceeded = q.flushLocked()
+	return q.exceeded
+}
+
+// exceededError returns the error the stream must terminate with when it went over
+// quota, nil otherwise.
+func (q *quotaStream) exceededError() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.exceeded
+}
+
+// flush accounts the pending usage, it is called one last time when the stream ends
+func (q *quotaStream) flush() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.flushLocked()
+}
+
+func (q *quotaStream) flushLocked() error {
+	if q.pendingBlocks == 0 && q.pendingEgressBytes == 0 {
+		return nil
+	}
+	err := q.enforcer.Account(q.auth, q.pendingBlocks, q.pendingEgressBytes)
+	q.pendingBlocks, q.pendingEgressBytes = 0, 0
+	return err
+}
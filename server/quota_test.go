@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dauth"
+	"github.com/streamingfast/firehose"
+	"github.com/streamingfast/firehose/quota"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestQuotaStream(t *testing.T) {
+	enforcer, err := quota.New(quota.Config{
+		StorePath:     filepath.Join(t.TempDir(), "quotas.json"),
+		Default:       quota.Plan{MonthlyBlocks: 2},
+		CheckInterval: time.Nanosecond,
+	}, zap.NewNop())
+	require.NoError(t, err)
+	defer enforcer.Close()
+
+	auth := dauth.TrustedHeaders{dauth.SFHeaderUserID: "alice"}
+	inner := &sentCounterStream{}
+	q := newQuotaStream(enforcer, auth)
+	q.Stream_BlocksServer = inner
+
+	require.NoError(t, q.Send(&pbfirehose.Response{Step: pbfirehose.ForkStep_STEP_NEW}))
+	require.NoError(t, q.Send(&pbfirehose.Response{Step: pbfirehose.ForkStep_STEP_UNSET}), "segment boundaries are not counted")
+
+	err = q.Send(&pbfirehose.Response{Step: pbfirehose.ForkStep_STEP_NEW})
+	var errQuotaExceeded *firehose.ErrQuotaExceeded
+	require.ErrorAs(t, err, &errQuotaExceeded)
+	assert.Equal(t, quota.MonthlyBlocks, errQuotaExceeded.Quota)
+	assert.Equal(t, 3, inner.sent, "the block reaching the quota is still sent")
+
+	assert.Equal(t, err, q.Send(&pbfirehose.Response{Step: pbfirehose.ForkStep_STEP_NEW}))
+	assert.Equal(t, 3, inner.sent)
+
+	assert.Equal(t, uint64(2), enforcer.Usage("alice").Blocks)
+	assert.Error(t, enforcer.Check(auth))
+}
+
+// failingBlocksServer receives `accepted` responses, then fails like a disconnected client
+type failingBlocksServer struct {
+	testServerStream
+	accepted int
+}
+
+func (s *failingBlocksServer) Send(*pbfirehose.Response) error {
+	if s.sent >= s.accepted {
+		return errors.New("client disconnected")
+	}
+	s.sent++
+	return nil
+}
+
+func newQuotaTestServer(t *testing.T, plan quota.Plan, checkInterval time.Duration) (*Server, *quota.Enforcer, *collectingEmitter) {
+	t.Helper()
+
+	enforcer, err := quota.New(quota.Config{
+		StorePath:     filepath.Join(t.TempDir(), "quotas.json"),
+		Default:       plan,
+		CheckInterval: checkInterval,
+	}, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { enforcer.Close() })
+
+	s, emitter := newMeteringTestServer(t)
+	WithQuotas(enforcer)(s)
+	WithSendBuffer(1024*1024, 0)(s)
+	return s, enforcer, emitter
+}
+
+func TestQuotaAccountsDeliveredResponses(t *testing.T) {
+	s, enforcer, emitter := newQuotaTestServer(t, quota.Plan{MonthlyBlocks: 100}, time.Hour)
+	ctx := dauth.WithTrustedHeaders(context.Background(), dauth.TrustedHeaders{dauth.SFHeaderUserID: "alice"})
+
+	srv := &failingBlocksServer{testServerStream: testServerStream{ctx: ctx}, accepted: 1}
+	err := s.Blocks(&pbfirehose.Request{StartBlockNum: 2, StopBlockNum: 5}, srv)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	assert.Equal(t, uint64(1), enforcer.Usage("alice").Blocks, "buffered responses dropped are not charged")
+	assert.Equal(t, float64(1), meteringTotals(emitter.events)["block_count"], "metered like quotas")
+}
+
+func TestQuotaExceededWithSendBuffer(t *testing.T) {
+	s, enforcer, _ := newQuotaTestServer(t, quota.Plan{MonthlyBlocks: 2}, time.Nanosecond)
+	ctx := dauth.WithTrustedHeaders(context.Background(), dauth.TrustedHeaders{dauth.SFHeaderUserID: "alice"})
+
+	srv := newCollectingBlocksServer(ctx)
+	err := s.Blocks(&pbfirehose.Request{StartBlockNum: 2, StopBlockNum: 5}, srv)
+
+	var errQuotaExceeded *firehose.ErrQuotaExceeded
+	require.ErrorAs(t, err, &errQuotaExceeded)
+	assert.Len(t, srv.sent(), 2, "the block reaching the quota is still sent")
+	assert.Equal(t, uint64(2), enforcer.Usage("alice").Blocks)
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/streamingfast/bstream"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ReorgModeHeader is the request metadata key used by clients to select how
+// chain reorganizations are sent back to them.
+const ReorgModeHeader = "x-firehose-reorg-mode"
+
+// ReorgModeConsolidated, when set as the value of ReorgModeHeader, replaces the
+// sequence of STEP_UNDO responses (one per undone block, each carrying the full
+// block) by a single STEP_UNDO response. Its `Block` field is a
+// `google.protobuf.Struct` holding the `common_ancestor` block reference and
+// the `undone_blocks` references, from highest to lowest. Its `Cursor` can be
+// used to resume right after the reorg. The new canonical blocks then follow
+// as STEP_NEW. Requests with passthrough transforms cannot use it.
+const ReorgModeConsolidated = "consolidated"
+
+func consolidatedReorgRequested(ctx context.Context) bool {
+	return incomingHeader(ctx, ReorgModeHeader) == ReorgModeConsolidated
+}
+
+// maxKnownBlocks bounds how many of the last blocks sent a reorgConsolidator
+// remembers to resolve common ancestors.
+const maxKnownBlocks = 1024
+
+// reorgConsolidator accumulates consecutive undone blocks until a non-undo step
+// is seen or the stream ends, at which point they are flushed as a single response.
+type reorgConsolidator struct {
+	parentRef  func(*bstream.Block) bstream.BlockRef
+	signCursor func(*bstream.Cursor) string
+
+	// known holds the numbers of the last blocks sent by ID, the common ancestor
+	// of a reorg is usually one of them so it does not need to be looked up.
+	known      map[string]uint64
+	knownOrder []string
+
+	undone     []bstream.BlockRef
+	lastUndone *bstream.Block
+	lastCursor *bstream.Cursor
+}
+
+func newReorgConsolidator(parentRef func(*bstream.Block) bstream.BlockRef, signCursor func(*bstream.Cursor) string) *reorgConsolidator {
+	return &reorgConsolidator{
+		parentRef:  parentRef,
+		signCursor: signCursor,
+		known:      make(map[string]uint64),
+	}
+}
+
+// sent records a block sent to the client
+func (c *reorgConsolidator) sent(block *bstream.Block) {
+	if _, found := c.known[block.Id]; found {
+		return
+	}
+	if len(c.knownOrder) == maxKnownBlocks {
+		delete(c.known, c.knownOrder[0])
+		c.knownOrder = c.knownOrder[1:]
+	}
+	c.known[block.Id] = block.Number
+	c.knownOrder = append(c.knownOrder, block.Id)
+}
+
+func (c *reorgConsolidator) add(block *bstream.Block, cursor *bstream.Cursor) {
+	c.undone = append(c.undone, block.AsRef())
+	c.lastUndone = block
+	c.lastCursor = cursor
+}
+
+func (c *reorgConsolidator) pending() bool {
+	return len(c.undone) != 0
+}
+
+func (c *reorgConsolidator) flush() (*pbfirehose.Response, error) {
+	undone := make([]interface{}, len(c.undone))
+	for i, ref := range c.undone {
+		undone[i] = blockRefToMap(ref)
+	}
+
+	payload, err := structpb.NewStruct(map[string]interface{}{
+		"common_ancestor": blockRefToMap(c.commonAncestor()),
+		"undone_blocks":   undone,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("building reorg payload: %w", err)
+	}
+
+	cnt, err := anypb.New(payload)
+	if err != nil {
+		return nil, fmt.Errorf("to any: %w", err)
+	}
+
+	resp := &pbfirehose.Response{
+		Step:   pbfirehose.ForkStep_STEP_UNDO,
+		Cursor: c.signCursor(c.lastCursor),
+		Block:  cnt,
+	}
+
+	c.undone = nil
+	c.lastUndone = nil
+	c.lastCursor = nil
+
+	return resp, nil
+}
+
+// commonAncestor is the parent of the lowest undone block
+func (c *reorgConsolidator) commonAncestor() bstream.BlockRef {
+	if num, found := c.known[c.lastUndone.PreviousId]; found {
+		return bstream.NewBlockRef(c.lastUndone.PreviousId, num)
+	}
+	return c.parentRef(c.lastUndone)
+}
+
+func blockRefToMap(ref bstream.BlockRef) map[string]interface{} {
+	return map[string]interface{}{
+		"num": float64(ref.Num()),
+		"id":  ref.ID(),
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/streamingfast/bstream"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func testReorgConsolidator(parentRefs *int) *reorgConsolidator {
+	return newReorgConsolidator(func(blk *bstream.Block) bstream.BlockRef {
+		*parentRefs++
+		return bstream.NewBlockRef(blk.PreviousId, blk.Number-1)
+	}, func(cursor *bstream.Cursor) string {
+		return "signed:" + cursor.Block.ID()
+	})
+}
+
+func undoCursor(blk *bstream.Block) *bstream.Cursor {
+	return &bstream.Cursor{Step: bstream.StepUndo, Block: blk, LIB: bstream.NewBlockRef("00000001a", 1), HeadBlock: blk}
+}
+
+func reorgPayload(t *testing.T, resp *pbfirehose.Response) map[string]interface{} {
+	t.Helper()
+
+	payload := &structpb.Struct{}
+	require.NoError(t, resp.Block.UnmarshalTo(payload))
+	return payload.AsMap()
+}
+
+func TestReorgConsolidator(t *testing.T) {
+	var parentRefs int
+	reorgs := testReorgConsolidator(&parentRefs)
+	assert.False(t, reorgs.pending())
+
+	// 00000002a was sent at number 2, 00000005b skips numbers 3 and 4
+	reorgs.sent(testBlock("00000002a", "00000001a"))
+	reorgs.sent(testBlock("00000005b", "00000002a"))
+	reorgs.sent(testBlock("00000006b", "00000005b"))
+
+	reorgs.add(testBlock("00000006b", "00000005b"), undoCursor(testBlock("00000006b", "00000005b")))
+	reorgs.add(testBlock("00000005b", "00000002a"), undoCursor(testBlock("00000005b", "00000002a")))
+	require.True(t, reorgs.pending())
+
+	resp, err := reorgs.flush()
+	require.NoError(t, err)
+	assert.False(t, reorgs.pending())
+	assert.Equal(t, pbfirehose.ForkStep_STEP_UNDO, resp.Step)
+	assert.Equal(t, "signed:00000005b", resp.Cursor)
+	assert.Equal(t, map[string]interface{}{
+		"common_ancestor": map[string]interface{}{"num": float64(2), "id": "00000002a"},
+		"undone_blocks": []interface{}{
+			map[string]interface{}{"num": float64(6), "id": "00000006b"},
+			map[string]interface{}{"num": float64(5), "id": "00000005b"},
+		},
+	}, reorgPayload(t, resp))
+	assert.Equal(t, 0, parentRefs, "the common ancestor was sent on the stream")
+
+	// the parent of 00000009c was never sent, it is looked up
+	reorgs.add(testBlock("00000009c", "00000008c"), undoCursor(testBlock("00000009c", "00000008c")))
+	resp, err = reorgs.flush()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"num": float64(8), "id": "00000008c"}, reorgPayload(t, resp)["common_ancestor"])
+	assert.Equal(t, 1, parentRefs)
+}
+
+func TestReorgConsolidatorKnownBlocksBounded(t *testing.T) {
+	var parentRefs int
+	reorgs := testReorgConsolidator(&parentRefs)
+
+	for i := uint64(1); i <= maxKnownBlocks+10; i++ {
+		reorgs.sent(&bstream.Block{Id: bstream.NewBlockRef("", i).String(), Number: i})
+	}
+	assert.Len(t, reorgs.known, maxKnownBlocks)
+	assert.Len(t, reorgs.knownOrder, maxKnownBlocks)
+}
+
+func TestSendConsolidatedReorg(t *testing.T) {
+	s := &Server{logger: zap.NewNop()}
+	s.installDefaultHooks()
+
+	var parentRefs int
+	reorgs := testReorgConsolidator(&parentRefs)
+	streamSrv := newCollectingBlocksServer(context.Background())
+
+	ctx := withRequestMeter(context.Background())
+	require.NoError(t, s.sendConsolidatedReorg(ctx, &pbfirehose.Request{}, reorgs, streamSrv, zap.NewNop()))
+	assert.Empty(t, streamSrv.sent(), "nothing pending")
+
+	reorgs.add(testBlock("00000003b", "00000002a"), undoCursor(testBlock("00000003b", "00000002a")))
+	require.NoError(t, s.sendConsolidatedReorg(ctx, &pbfirehose.Request{}, reorgs, streamSrv, zap.NewNop()))
+	require.Len(t, streamSrv.sent(), 1)
+	assert.Equal(t, "signed:00000003b", streamSrv.sent()[0].Cursor)
+	assert.False(t, reorgs.pending())
+}
+
+func TestConsolidatedReorgRejectedWithPassthrough(t *testing.T) {
+	s, _ := newMeteringTestServer(t)
+	passthroughTransform, err := anypb.New(wrapperspb.String("config"))
+	require.NoError(t, err)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(ReorgModeHeader, ReorgModeConsolidated))
+	srv := newCollectingBlocksServer(ctx)
+	err = s.Blocks(&pbfirehose.Request{StartBlockNum: 2, StopBlockNum: 4, Transforms: []*anypb.Any{passthroughTransform}}, srv)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Empty(t, srv.sent())
+}
@@ -0,0 +1,22 @@
+package server
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// incomingHeader returns the last value of the request metadata `key`, or an empty
+// string if it was not sent by the client.
+func incomingHeader(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"github.com/streamingfast/bstream"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+)
+
+// Response header metadata keys sent according to the configured ResponseHeaders, the
+// resolved start block being sent under ResolvedStartBlockHeader.
+const (
+	ServerVersionHeader = "x-firehose-server-version"
+	ChainIDHeader       = "x-firehose-chain-id"
+	HeadBlockHeader     = "x-firehose-head-block"
+	TraceIDHeader       = "x-firehose-trace-id"
+	RegionHeader        = "x-firehose-region"
+	HostnameHeader      = "hostname"
+)
+
+// ResponseHeaders defines the metadata sent in the response headers of `Blocks`, `Block`
+// and the v1 `Blocks` proxy. Empty strings and false values are not sent.
+type ResponseHeaders struct {
+	Version string
+	ChainID string
+	Region  string
+
+	// ResolvedStartBlock sends the number of the first block streamed, after resolution
+	// of cursors, relative start blocks and descending order.
+	ResolvedStartBlock bool
+
+	// HeadBlock sends the head block number of the server when the request is received.
+	HeadBlock bool
+
+	// TraceID sends the ID of the trace the request is part of.
+	TraceID bool
+
+	// Hostname sends the hostname of the server, also enabled by setting the
+	// `FIREHOSE_SEND_HOSTNAME` environment variable.
+	Hostname bool
+}
+
+func WithResponseHeaders(headers ResponseHeaders) Option {
+	return func(s *Server) {
+		s.responseHeaders = headers
+	}
+}
+
+// responseHeader builds the headers common to all endpoints
+func (s *Server) responseHeader(ctx context.Context, logger *zap.Logger) metadata.MD {
+	header := metadata.MD{}
+	conf := s.responseHeaders
+
+	if conf.Version != "" {
+		header.Set(ServerVersionHeader, conf.Version)
+	}
+	if conf.ChainID != "" {
+		header.Set(ChainIDHeader, conf.ChainID)
+	}
+	if conf.Region != "" {
+		header.Set(RegionHeader, conf.Region)
+	}
+
+	if conf.HeadBlock {
+		if headNum := s.streamFactory.HeadNum(); headNum != 0 {
+			header.Set(HeadBlockHeader, strconv.FormatUint(headNum, 10))
+		}
+	}
+
+	if conf.TraceID {
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+			header.Set(TraceIDHeader, spanContext.TraceID().String())
+		}
+	}
+
+	if conf.Hostname || os.Getenv("FIREHOSE_SEND_HOSTNAME") != "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "unknown"
+			logger.Warn("cannot determine hostname, using 'unknown'", zap.Error(err))
+		}
+		header.Set(HostnameHeader, hostname)
+	}
+
+	return header
+}
+
+// resolvedStartBlock returns the number of the first block a request streams. A cursor
+// resumes after its block, at the block before it for descending requests, and a
+// descending request without cursor starts at its stop block. Negative start blocks are
+// resolved against the head block. It returns false when the block cannot be determined.
+func (s *Server) resolvedStartBlock(request *pbfirehose.Request, descending bool) (uint64, bool) {
+	if request.Cursor != "" {
+		cursor, err := s.streamFactory.DecodeCursor(request.Cursor)
+		if err != nil {
+			return 0, false
+		}
+
+		blockNum := cursor.Block.Num()
+		switch {
+		case descending:
+			if blockNum == 0 {
+				return 0, false
+			}
+			return blockNum - 1, true
+		case cursor.Step.Matches(bstream.StepUndo):
+			// the undone block is replaced by a block of the canonical chain at its height
+			return blockNum, true
+		default:
+			return blockNum + 1, true
+		}
+	}
+
+	if descending {
+		return request.StopBlockNum, request.StopBlockNum != 0
+	}
+
+	if request.StartBlockNum >= 0 {
+		return uint64(request.StartBlockNum), true
+	}
+
+	headNum := s.streamFactory.HeadNum()
+	if headNum == 0 {
+		return 0, false
+	}
+
+	offset := uint64(-request.StartBlockNum)
+	if offset >= headNum {
+		return 0, true
+	}
+	return headNum - offset, true
+}
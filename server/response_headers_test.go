@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/firehose"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func TestResponseHeader(t *testing.T) {
+	t.Setenv("FIREHOSE_SEND_HOSTNAME", "")
+
+	s := &Server{responseHeaders: ResponseHeaders{
+		Version: "v1.2.3",
+		ChainID: "mainnet",
+		TraceID: true,
+	}}
+
+	traceID := trace.TraceID{0x01, 0x02}
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  trace.SpanID{0x01},
+	}))
+
+	header := s.responseHeader(ctx, zap.NewNop())
+	assert.Equal(t, []string{"v1.2.3"}, header.Get(ServerVersionHeader))
+	assert.Equal(t, []string{"mainnet"}, header.Get(ChainIDHeader))
+	assert.Equal(t, []string{traceID.String()}, header.Get(TraceIDHeader))
+	assert.Empty(t, header.Get(RegionHeader), "empty values are not sent")
+	assert.Empty(t, header.Get(HostnameHeader))
+
+	assert.Empty(t, s.responseHeader(context.Background(), zap.NewNop()).Get(TraceIDHeader), "no trace")
+}
+
+func TestResolvedStartBlock(t *testing.T) {
+	s := &Server{streamFactory: firehose.NewStreamFactory(nil, nil, nil, nil)}
+
+	cursor := func(step bstream.StepType, num uint64) string {
+		ref := bstream.NewBlockRef("0000000a", num)
+		return (&bstream.Cursor{Step: step, Block: ref, HeadBlock: ref, LIB: ref}).ToOpaque()
+	}
+
+	tests := []struct {
+		name       string
+		request    *pbfirehose.Request
+		descending bool
+		expected   uint64
+		expectedOk bool
+	}{
+		{"start block", &pbfirehose.Request{StartBlockNum: 5, StopBlockNum: 20}, false, 5, true},
+		{"cursor", &pbfirehose.Request{StartBlockNum: 5, Cursor: cursor(bstream.StepNew, 10)}, false, 11, true},
+		{"final cursor", &pbfirehose.Request{StartBlockNum: 5, Cursor: cursor(bstream.StepIrreversible, 10)}, false, 11, true},
+		{"undo cursor", &pbfirehose.Request{StartBlockNum: 5, Cursor: cursor(bstream.StepUndo, 10)}, false, 10, true},
+		{"invalid cursor", &pbfirehose.Request{StartBlockNum: 5, Cursor: "invalid"}, false, 0, false},
+		{"descending", &pbfirehose.Request{StartBlockNum: 5, StopBlockNum: 20}, true, 20, true},
+		{"descending cursor", &pbfirehose.Request{StartBlockNum: 5, StopBlockNum: 20, Cursor: firehose.EncodeDescendingCursor(cursor(bstream.StepIrreversible, 10))}, true, 9, true},
+		{"descending unbounded", &pbfirehose.Request{StartBlockNum: 5}, true, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			blockNum, ok := s.resolvedStartBlock(test.request, test.descending)
+			assert.Equal(t, test.expectedOk, ok)
+			assert.Equal(t, test.expected, blockNum)
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/firehose/metrics"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/protobuf/proto"
+)
+
+// WithSendBuffer decouples the reading of blocks from the sending of responses to the
+// client: responses are queued and sent by a dedicated goroutine, so store reads and
+// decoding overlap with network writes. Each stream can buffer up to `streamBytes` bytes
+// of responses and all streams together up to `totalBytes` bytes (0 means no global
+// limit). Once a limit is reached, producing the next response waits for the client to
+// catch up.
+func WithSendBuffer(streamBytes int64, totalBytes int64) Option {
+	return func(s *Server) {
+		if streamBytes <= 0 {
+			return
+		}
+		s.sendBufferStreamBytes = streamBytes
+		if totalBytes > 0 {
+			s.sendBufferBudget = semaphore.NewWeighted(totalBytes)
+			s.sendBufferTotalBytes = totalBytes
+		}
+	}
+}
+
+// sendBufferFlushTimeout bounds how long a terminating stream waits for the client to
+// receive the responses still buffered, a client that stopped reading must not hold the
+// stream forever.
+const sendBufferFlushTimeout = 30 * time.Second
+
+type bufferedResponse struct {
+	resp           *pbfirehose.Response
+	size           int64
+	streamReserved int64
+	globalReserved int64
+}
+
+// sendBuffer is a pbfirehose.Stream_BlocksServer queuing responses to be sent by its
+// own goroutine. The first error returned by the underlying stream is returned by all
+// subsequent calls to Send and by close.
+type sendBuffer struct {
+	pbfirehose.Stream_BlocksServer
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	queue  chan *bufferedResponse
+	failed chan struct{}
+	done   chan struct{}
+	err    error
+
+	streamBudget     *semaphore.Weighted
+	streamBudgetSize int64
+	globalBudget     *semaphore.Weighted
+	globalBudgetSize int64
+
+	flushTimeout time.Duration
+	closeOnce    sync.Once
+	closeErr     error
+}
+
+func (s *Server) newSendBuffer(ctx context.Context, next pbfirehose.Stream_BlocksServer) *sendBuffer {
+	ctx, cancel := context.WithCancel(ctx)
+	b := &sendBuffer{
+		Stream_BlocksServer: next,
+		ctx:                 ctx,
+		cancel:              cancel,
+		queue:               make(chan *bufferedResponse, 1024),
+		failed:              make(chan struct{}),
+		done:                make(chan struct{}),
+		streamBudget:        semaphore.NewWeighted(s.sendBufferStreamBytes),
+		streamBudgetSize:    s.sendBufferStreamBytes,
+		globalBudget:        s.sendBufferBudget,
+		globalBudgetSize:    s.sendBufferTotalBytes,
+		flushTimeout:        sendBufferFlushTimeout,
+	}
+
+	go b.run()
+	return b
+}
+
+func (b *sendBuffer) Send(resp *pbfirehose.Response) error {
+	select {
+	case <-b.failed:
+		return b.err
+	default:
+	}
+
+	item := &bufferedResponse{
+		resp: resp,
+		size: int64(proto.Size(resp)),
+	}
+
+	// a response bigger than a budget must still be able to go through alone
+	item.streamReserved = min(item.size, b.streamBudgetSize)
+	if err := b.streamBudget.Acquire(b.ctx, item.streamReserved); err != nil {
+		return b.sendError(err)
+	}
+	if b.globalBudget != nil {
+		item.globalReserved = min(item.size, b.globalBudgetSize)
+		if err := b.globalBudget.Acquire(b.ctx, item.globalReserved); err != nil {
+			b.streamBudget.Release(item.streamReserved)
+			return b.sendError(err)
+		}
+	}
+	metrics.SendBufferBytes.Native().Add(float64(item.size))
+
+	select {
+	case b.queue <- item:
+		return nil
+	case <-b.failed:
+		b.release(item)
+		return b.err
+	}
+}
+
+func (b *sendBuffer) sendError(ctxErr error) error {
+	select {
+	case <-b.failed:
+		return b.err
+	default:
+		return ctxErr
+	}
+}
+
+func (b *sendBuffer) run() {
+	defer close(b.done)
+
+	for item := range b.queue {
+		if b.ctx.Err() != nil {
+			// discarded, nothing more will reach the client
+			b.release(item)
+			continue
+		}
+
+		err := b.Stream_BlocksServer.Send(item.resp)
+		b.release(item)
+
+		if err != nil {
+			b.err = err
+			close(b.failed)
+			b.cancel()
+			for item := range b.queue {
+				b.release(item)
+			}
+			return
+		}
+	}
+}
+
+func (b *sendBuffer) release(item *bufferedResponse) {
+	b.streamBudget.Release(item.streamReserved)
+	if b.globalBudget != nil {
+		b.globalBudget.Release(item.globalReserved)
+	}
+	metrics.SendBufferBytes.Native().Sub(float64(item.size))
+}
+
+// close waits until all the queued responses are sent, it must only be called once
+// nothing calls Send anymore. When the client does not receive them within the flush
+// timeout, the remaining ones are dropped and an error is returned.
+func (b *sendBuffer) close() error {
+	b.closeOnce.Do(func() {
+		close(b.queue)
+		if !b.wait() {
+			b.closeErr = fmt.Errorf("client did not receive the buffered responses within %s", b.flushTimeout)
+			return
+		}
+		b.closeErr = b.err
+	})
+	return b.closeErr
+}
+
+// discard drops the queued responses without sending them, used when the stream
+// terminates with an error. It waits for the response being sent, if any, so that
+// nothing is sent once the stream terminated, unless the client does not receive it
+// within the flush timeout.
+func (b *sendBuffer) discard() {
+	b.closeOnce.Do(func() {
+		b.cancel()
+		close(b.queue)
+		b.wait()
+	})
+}
+
+// wait returns true once the sending goroutine returned, false if it is still sending
+// after the flush timeout. The queued responses are dropped in both cases.
+func (b *sendBuffer) wait() bool {
+	defer b.cancel()
+
+	timer := time.NewTimer(b.flushTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-b.done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
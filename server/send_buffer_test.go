@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/protobuf/proto"
+)
+
+// gatedBlocksServer records the responses it receives, each send waiting for a token
+// on `gate` when it is set
+type gatedBlocksServer struct {
+	testServerStream
+	gate chan struct{}
+
+	mu       sync.Mutex
+	sending  bool
+	received []string
+}
+
+func (s *gatedBlocksServer) Send(resp *pbfirehose.Response) error {
+	s.mu.Lock()
+	s.sending = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.sending = false
+		s.mu.Unlock()
+	}()
+
+	if s.gate != nil {
+		if _, ok := <-s.gate; !ok {
+			return errors.New("client gone")
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received = append(s.received, resp.Cursor)
+	return nil
+}
+
+func (s *gatedBlocksServer) state() (sending bool, received []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sending, append([]string(nil), s.received...)
+}
+
+func newTestSendBuffer(client pbfirehose.Stream_BlocksServer, streamBytes, totalBytes int64) *sendBuffer {
+	s := &Server{}
+	WithSendBuffer(streamBytes, totalBytes)(s)
+	return s.newSendBuffer(context.Background(), client)
+}
+
+func testResponse(i int) *pbfirehose.Response {
+	return &pbfirehose.Response{Step: pbfirehose.ForkStep_STEP_NEW, Cursor: "cursor-" + strconv.Itoa(i)}
+}
+
+// assertSendBufferReleased checks that nothing is left reserved from the budgets of `b`
+func assertSendBufferReleased(t *testing.T, b *sendBuffer) {
+	t.Helper()
+
+	require.True(t, b.streamBudget.TryAcquire(b.streamBudgetSize), "stream budget not released")
+	b.streamBudget.Release(b.streamBudgetSize)
+	if b.globalBudget != nil {
+		require.True(t, b.globalBudget.TryAcquire(b.globalBudgetSize), "global budget not released")
+		b.globalBudget.Release(b.globalBudgetSize)
+	}
+}
+
+func TestSendBufferOrdering(t *testing.T) {
+	client := &gatedBlocksServer{testServerStream: testServerStream{ctx: context.Background()}}
+	buffer := newTestSendBuffer(client, 1024, 4096)
+
+	var expected []string
+	for i := 0; i < 200; i++ {
+		require.NoError(t, buffer.Send(testResponse(i)))
+		expected = append(expected, testResponse(i).Cursor)
+	}
+	require.NoError(t, buffer.close())
+
+	_, received := client.state()
+	assert.Equal(t, expected, received)
+	assertSendBufferReleased(t, buffer)
+}
+
+func TestSendBufferByteBudget(t *testing.T) {
+	client := &gatedBlocksServer{testServerStream: testServerStream{ctx: context.Background()}, gate: make(chan struct{})}
+	responseSize := int64(proto.Size(testResponse(0)))
+	buffer := newTestSendBuffer(client, 3*responseSize, 0)
+
+	// the first response is being sent, the budget of a response being sent is only
+	// released once the client received it
+	for i := 0; i < 3; i++ {
+		require.NoError(t, buffer.Send(testResponse(i)))
+	}
+
+	sent := make(chan error)
+	go func() { sent <- buffer.Send(testResponse(3)) }()
+
+	select {
+	case <-sent:
+		t.Fatal("send should wait for the client to catch up")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	client.gate <- struct{}{}
+	require.NoError(t, <-sent, "the budget of a sent response is released")
+
+	close(client.gate)
+	buffer.discard()
+	assertSendBufferReleased(t, buffer)
+}
+
+func TestSendBufferGlobalBudget(t *testing.T) {
+	responseSize := int64(proto.Size(testResponse(0)))
+	globalBudget := semaphore.NewWeighted(responseSize)
+
+	s := &Server{sendBufferStreamBytes: 10 * responseSize, sendBufferBudget: globalBudget, sendBufferTotalBytes: responseSize}
+	stalled := &gatedBlocksServer{testServerStream: testServerStream{ctx: context.Background()}, gate: make(chan struct{})}
+	buffer := s.newSendBuffer(context.Background(), stalled)
+	require.NoError(t, buffer.Send(testResponse(0)))
+
+	assert.False(t, globalBudget.TryAcquire(1), "the stalled stream holds the global budget")
+
+	close(stalled.gate)
+	buffer.discard()
+	assert.True(t, globalBudget.TryAcquire(responseSize), "the global budget is released once discarded")
+}
+
+func TestSendBufferDiscard(t *testing.T) {
+	client := &gatedBlocksServer{testServerStream: testServerStream{ctx: context.Background()}, gate: make(chan struct{})}
+	buffer := newTestSendBuffer(client, 1024, 0)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, buffer.Send(testResponse(i)))
+	}
+	require.Eventually(t, func() bool { sending, _ := client.state(); return sending }, time.Second, time.Millisecond)
+
+	discarded := make(chan struct{})
+	go func() {
+		buffer.discard()
+		close(discarded)
+	}()
+
+	select {
+	case <-discarded:
+		t.Fatal("discard must wait for the response being sent")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	client.gate <- struct{}{}
+	<-discarded
+
+	sending, received := client.state()
+	assert.False(t, sending, "nothing is sent once discarded")
+	assert.Equal(t, []string{"cursor-0"}, received, "queued responses are dropped")
+	assertSendBufferReleased(t, buffer)
+}
+
+func TestSendBufferClose(t *testing.T) {
+	t.Run("flushes", func(t *testing.T) {
+		client := &gatedBlocksServer{testServerStream: testServerStream{ctx: context.Background()}, gate: make(chan struct{}, 3)}
+		buffer := newTestSendBuffer(client, 1024, 0)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, buffer.Send(testResponse(i)))
+			client.gate <- struct{}{}
+		}
+
+		require.NoError(t, buffer.close())
+		_, received := client.state()
+		assert.Len(t, received, 3)
+		assertSendBufferReleased(t, buffer)
+	})
+
+	t.Run("client error", func(t *testing.T) {
+		client := &gatedBlocksServer{testServerStream: testServerStream{ctx: context.Background()}, gate: make(chan struct{})}
+		buffer := newTestSendBuffer(client, 1024, 0)
+		require.NoError(t, buffer.Send(testResponse(0)))
+		close(client.gate)
+
+		assert.EqualError(t, buffer.close(), "client gone")
+		assert.EqualError(t, buffer.Send(testResponse(1)), "client gone")
+	})
+
+	t.Run("stalled client", func(t *testing.T) {
+		client := &gatedBlocksServer{testServerStream: testServerStream{ctx: context.Background()}, gate: make(chan struct{})}
+		defer close(client.gate)
+		buffer := newTestSendBuffer(client, 1024, 0)
+		buffer.flushTimeout = 20 * time.Millisecond
+		require.NoError(t, buffer.Send(testResponse(0)))
+		require.NoError(t, buffer.Send(testResponse(1)))
+
+		start := time.Now()
+		assert.Error(t, buffer.close())
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
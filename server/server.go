@@ -12,18 +12,20 @@ import (
 	dauthgrpc "github.com/streamingfast/dauth/middleware/grpc"
 	dgrpcserver "github.com/streamingfast/dgrpc/server"
 	"github.com/streamingfast/dgrpc/server/factory"
-	"github.com/streamingfast/dmetering"
 	"github.com/streamingfast/dmetrics"
 	"github.com/streamingfast/firehose"
+	pbcursor "github.com/streamingfast/firehose/pb/streamingfast/firehose/cursor/v1"
+	"github.com/streamingfast/firehose/quota"
 	"github.com/streamingfast/firehose/rate"
 	pbfirehoseV1 "github.com/streamingfast/pbgo/sf/firehose/v1"
 	pbfirehoseV2 "github.com/streamingfast/pbgo/sf/firehose/v2"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.opentelemetry.io/otel"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
 	"google.golang.org/grpc"
 	_ "google.golang.org/grpc/encoding/gzip"
-	"google.golang.org/protobuf/proto"
 )
 
 type Server struct {
@@ -31,8 +33,12 @@ type Server struct {
 	transformRegistry *transform.Registry
 	blockGetter       *firehose.BlockGetter
 
-	initFunc     func(context.Context, *pbfirehoseV2.Request) context.Context
-	postHookFunc func(context.Context, *pbfirehoseV2.Response)
+	requestStartHooks           []RequestStartHook
+	responseHooks               []ResponseHook
+	requestEndHooks             []RequestEndHook
+	disableDefaultMeteringHooks bool
+	meteringAggregation         MeteringAggregation
+	metering                    *meteringHooks // nil when the default metering hooks are disabled
 
 	dgrpcserver.Server
 	listenAddr       string
@@ -41,6 +47,18 @@ type Server struct {
 	metrics          dmetrics.Set
 
 	rateLimiter rate.Limiter
+
+	streams *activeStreams
+
+	slowConsumerPolicy *SlowConsumerPolicy
+	responseHeaders    ResponseHeaders
+	requestPolicies    *RequestPolicies
+	quotas             *quota.Enforcer
+	auditWriter        AuditWriter
+
+	sendBufferStreamBytes int64
+	sendBufferTotalBytes  int64
+	sendBufferBudget      *semaphore.Weighted
 }
 
 type Option func(*Server)
@@ -62,48 +80,15 @@ func New(
 	serviceDiscoveryURL *url.URL,
 	opts ...Option,
 ) *Server {
-	initFunc := func(ctx context.Context, request *pbfirehoseV2.Request) context.Context {
-		//////////////////////////////////////////////////////////////////////
-		ctx = dmetering.WithBytesMeter(ctx)
-		ctx = withRequestMeter(ctx)
-		return ctx
-		//////////////////////////////////////////////////////////////////////
-	}
-
-	postHookFunc := func(ctx context.Context, response *pbfirehoseV2.Response) {
-		//////////////////////////////////////////////////////////////////////
-		meter := dmetering.GetBytesMeter(ctx)
-		bytesRead := meter.BytesReadDelta()
-		bytesWritten := meter.BytesWrittenDelta()
-		size := proto.Size(response)
-
-		auth := dauth.FromContext(ctx)
-		event := dmetering.Event{
-			UserID:    auth.UserID(),
-			ApiKeyID:  auth.APIKeyID(),
-			IpAddress: auth.RealIP(),
-			Meta:      auth.Meta(),
-			Endpoint:  "sf.firehose.v2.Firehose/Blocks",
-			Metrics: map[string]float64{
-				"egress_bytes":  float64(size),
-				"written_bytes": float64(bytesWritten),
-				"read_bytes":    float64(bytesRead),
-				"block_count":   1,
-			},
-			Timestamp: time.Now(),
-		}
-
-		requestMeter := getRequestMeter(ctx)
-		requestMeter.blocks++
-		requestMeter.egressBytes += size
-		dmetering.Emit(ctx, event)
-		//////////////////////////////////////////////////////////////////////
+	streams := newActiveStreams()
+	isReadyAndNotDraining := func(ctx context.Context) bool {
+		return !streams.draining.Load() && isReady(ctx)
 	}
 
 	tracerProvider := otel.GetTracerProvider()
 	options := []dgrpcserver.Option{
 		dgrpcserver.WithLogger(logger),
-		dgrpcserver.WithHealthCheck(dgrpcserver.HealthCheckOverGRPC|dgrpcserver.HealthCheckOverHTTP, createHealthCheck(isReady)),
+		dgrpcserver.WithHealthCheck(dgrpcserver.HealthCheckOverGRPC|dgrpcserver.HealthCheckOverHTTP, createHealthCheck(isReadyAndNotDraining)),
 		dgrpcserver.WithPostUnaryInterceptor(otelgrpc.UnaryServerInterceptor(otelgrpc.WithTracerProvider(tracerProvider))),
 		dgrpcserver.WithPostStreamInterceptor(otelgrpc.StreamServerInterceptor(otelgrpc.WithTracerProvider(tracerProvider))),
 		dgrpcserver.WithGRPCServerOptions(grpc.MaxRecvMsgSize(25 * 1024 * 1024)),
@@ -129,9 +114,8 @@ func New(
 		blockGetter:       blockGetter,
 		streamFactory:     streamFactory,
 		listenAddr:        strings.ReplaceAll(listenAddr, "*", ""),
-		initFunc:          initFunc,
-		postHookFunc:      postHookFunc,
 		logger:            logger,
+		streams:           streams,
 	}
 
 	logger.Info("registering grpc services")
@@ -140,17 +124,23 @@ func New(
 			pbfirehoseV2.RegisterFetchServer(gs, s)
 		}
 		pbfirehoseV2.RegisterStreamServer(gs, s)
+		pbcursor.RegisterCursorInspectorServer(gs, s)
 		pbfirehoseV1.RegisterStreamServer(gs, NewFirehoseProxyV1ToV2(s)) // compatibility with firehose
 	})
 
 	for _, opt := range opts {
 		opt(s)
 	}
+	s.installDefaultHooks()
 
 	return s
 }
 
 func (s *Server) Launch() {
+	stopLiveLagReporter := make(chan struct{})
+	s.OnTerminated(func(error) { close(stopLiveLagReporter) })
+	go s.streams.runLiveLagReporter(liveLagReportInterval, stopLiveLagReporter)
+
 	s.Server.Launch(s.listenAddr)
 }
 
@@ -164,9 +154,12 @@ type key int
 
 var requestMeterKey key
 
+// requestMeter is updated by the response hooks, called from the goroutine of the send
+// buffer when there is one, hence the atomics.
 type requestMeter struct {
-	blocks      uint64
-	egressBytes int
+	endpoint    atomic.String
+	blocks      atomic.Uint64
+	egressBytes atomic.Int64
 }
 
 func getRequestMeter(ctx context.Context) *requestMeter {
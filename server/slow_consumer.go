@@ -0,0 +1,279 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/firehose"
+	"github.com/streamingfast/firehose/metrics"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"go.uber.org/zap"
+)
+
+// SlowConsumerPolicy defines when a consumer is considered slow and when it gets
+// disconnected. Zero values disable the corresponding check.
+type SlowConsumerPolicy struct {
+	// WarnSendDuration flags the consumer as slow, with a warning, when sending a single
+	// response takes longer than this.
+	WarnSendDuration time.Duration
+
+	// MaxHeadLag flags the consumer as slow when, after having caught up with the head
+	// block once, it falls more than this number of blocks behind it.
+	MaxHeadLag uint64
+
+	// DisconnectAfter terminates the stream with a `CLIENT_TOO_SLOW` error once the
+	// consumer has been slow for this long. Time spent healthy pays back time spent slow,
+	// so a consumer alternating slow and fast sends is still disconnected. A send blocked
+	// for WarnSendDuration plus DisconnectAfter, a client that stopped reading, also
+	// disconnects it.
+	DisconnectAfter time.Duration
+}
+
+func WithSlowConsumerPolicy(policy SlowConsumerPolicy) Option {
+	return func(s *Server) {
+		s.slowConsumerPolicy = &policy
+	}
+}
+
+type slowConsumerTracker struct {
+	policy  *SlowConsumerPolicy
+	headNum func() uint64
+	logger  *zap.Logger
+	now     func() time.Time
+
+	caughtUp     bool
+	lagReason    string
+	flagged      bool
+	slowFor      time.Duration
+	lastObserved time.Time
+}
+
+func newSlowConsumerTracker(policy *SlowConsumerPolicy, headNum func() uint64, logger *zap.Logger) *slowConsumerTracker {
+	return &slowConsumerTracker{
+		policy:       policy,
+		headNum:      headNum,
+		logger:       logger,
+		now:          time.Now,
+		lastObserved: time.Now(),
+	}
+}
+
+// observe is called after each successful send, `hasBlock` being false for responses
+// without a block like segment boundaries. It returns a firehose.ErrClientTooSlow when
+// the consumer must be disconnected.
+func (t *slowConsumerTracker) observe(blockNum uint64, hasBlock bool, sendDuration time.Duration, lastCursor string) error {
+	var reason string
+
+	if t.policy.WarnSendDuration > 0 && sendDuration > t.policy.WarnSendDuration {
+		reason = fmt.Sprintf("sending block %d took %s", blockNum, sendDuration)
+		t.logger.Warn("slow consumer: send took longer than threshold", zap.Uint64("block_num", blockNum), zap.Duration("duration", sendDuration), zap.Duration("threshold", t.policy.WarnSendDuration))
+	}
+
+	if t.policy.MaxHeadLag > 0 && hasBlock {
+		t.lagReason = ""
+		if head := t.headNum(); head != 0 {
+			var lag uint64
+			if head > blockNum {
+				lag = head - blockNum
+			}
+
+			if lag <= t.policy.MaxHeadLag {
+				t.caughtUp = true
+			} else if t.caughtUp {
+				t.lagReason = fmt.Sprintf("%d blocks behind head block %d", lag, head)
+			}
+		}
+	}
+	if reason == "" {
+		// responses without block keep the lag of the last block sent
+		reason = t.lagReason
+	}
+
+	now := t.now()
+	elapsed := now.Sub(t.lastObserved)
+	t.lastObserved = now
+
+	if reason == "" {
+		// a single fast send does not clear the consumer, only as much healthy time as
+		// it spent slow does
+		t.slowFor -= elapsed
+		if t.slowFor <= 0 {
+			t.slowFor = 0
+			t.unflag()
+		}
+		return nil
+	}
+
+	t.slowFor += elapsed
+	return t.slow(reason, lastCursor)
+}
+
+// stalled is called when a send is still in flight after watchdogDelay
+func (t *slowConsumerTracker) stalled(sendDuration time.Duration, lastCursor string) error {
+	t.slowFor += sendDuration - t.policy.WarnSendDuration
+	t.lastObserved = t.now()
+	return t.slow(fmt.Sprintf("send blocked for %s", sendDuration), lastCursor)
+}
+
+// watchdogDelay is how long a send can stay in flight before the consumer has been
+// slow for longer than DisconnectAfter
+func (t *slowConsumerTracker) watchdogDelay() time.Duration {
+	delay := t.policy.WarnSendDuration + t.policy.DisconnectAfter - t.slowFor
+	if delay < t.policy.WarnSendDuration {
+		delay = t.policy.WarnSendDuration
+	}
+	return delay
+}
+
+func (t *slowConsumerTracker) slow(reason string, lastCursor string) error {
+	if !t.flagged {
+		t.flagged = true
+		metrics.SlowConsumers.Inc()
+		t.logger.Info("consumer flagged as slow", zap.String("reason", reason))
+	}
+
+	if t.policy.DisconnectAfter > 0 && t.slowFor >= t.policy.DisconnectAfter {
+		t.logger.Info("disconnecting slow consumer", zap.String("reason", reason), zap.Duration("slow_for", t.slowFor))
+		return firehose.NewErrClientTooSlow(lastCursor, reason)
+	}
+
+	return nil
+}
+
+func (t *slowConsumerTracker) unflag() {
+	if t.flagged {
+		t.flagged = false
+		metrics.SlowConsumers.Dec()
+	}
+}
+
+// slowConsumerStream measures the sends of the summary stream it wraps, below the send
+// buffer, so that it observes when the client actually receives the responses. With a
+// DisconnectAfter policy, sends are made by a dedicated goroutine and a send still in
+// flight when the consumer has been slow for too long fails with a
+// firehose.ErrClientTooSlow, the stream terminating while the client is not reading.
+type slowConsumerStream struct {
+	pbfirehose.Stream_BlocksServer
+
+	summary *summaryStream
+
+	// the send buffer can still be sending when the stream is closed, after its flush
+	// timeout, so the tracker and the state of the stream are guarded
+	mu      sync.Mutex
+	tracker *slowConsumerTracker
+	stalled error
+	closed  bool
+
+	requests  chan *pbfirehose.Response
+	results   chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+var errSlowConsumerStreamClosed = errors.New("stream closed")
+
+func newSlowConsumerStream(summary *summaryStream, tracker *slowConsumerTracker) *slowConsumerStream {
+	s := &slowConsumerStream{
+		Stream_BlocksServer: summary,
+		summary:             summary,
+		tracker:             tracker,
+		done:                make(chan struct{}),
+	}
+
+	if tracker.policy.DisconnectAfter > 0 {
+		s.requests = make(chan *pbfirehose.Response)
+		s.results = make(chan error, 1)
+		go func() {
+			for {
+				select {
+				case resp := <-s.requests:
+					s.results <- s.Stream_BlocksServer.Send(resp)
+				case <-s.done:
+					return
+				}
+			}
+		}()
+	}
+	return s
+}
+
+func (s *slowConsumerStream) Send(resp *pbfirehose.Response) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errSlowConsumerStreamClosed
+	}
+	if s.stalled != nil {
+		s.mu.Unlock()
+		return s.stalled
+	}
+	s.mu.Unlock()
+
+	start := time.Now()
+	if err := s.send(resp, start); err != nil {
+		return err
+	}
+
+	blockNum, hasBlock := uint64(0), false
+	if resp.Step != pbfirehose.ForkStep_STEP_UNSET {
+		blockNum, hasBlock = cursorBlockNum(resp.Cursor)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	return s.tracker.observe(blockNum, hasBlock, time.Since(start), s.summary.lastSentCursor())
+}
+
+func (s *slowConsumerStream) send(resp *pbfirehose.Response, start time.Time) error {
+	if s.requests == nil {
+		return s.Stream_BlocksServer.Send(resp)
+	}
+
+	s.mu.Lock()
+	delay := s.tracker.watchdogDelay()
+	s.mu.Unlock()
+
+	select {
+	case s.requests <- resp:
+	case <-s.done:
+		return errSlowConsumerStreamClosed
+	}
+
+	watchdog := time.NewTimer(delay)
+	defer watchdog.Stop()
+
+	select {
+	case err := <-s.results:
+		return err
+	case <-watchdog.C:
+		// the send stays in flight until the stream terminates, nothing is sent after it
+		s.mu.Lock()
+		if !s.closed {
+			s.stalled = s.tracker.stalled(time.Since(start), s.summary.lastSentCursor())
+		}
+		stalled := s.stalled
+		s.mu.Unlock()
+
+		if stalled == nil {
+			return <-s.results
+		}
+		return stalled
+	}
+}
+
+// close stops the sending goroutine once the in-flight send, if any, returns. The send
+// buffer can still call Send afterwards, when it gave up flushing, it fails without
+// sending anything.
+func (s *slowConsumerStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	s.tracker.unflag()
+	s.closeOnce.Do(func() { close(s.done) })
+}
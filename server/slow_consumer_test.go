@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/firehose"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestSlowConsumerTracker(policy SlowConsumerPolicy, headNum func() uint64) (*slowConsumerTracker, func(time.Duration)) {
+	now := time.Unix(0, 0)
+	tracker := newSlowConsumerTracker(&policy, headNum, zap.NewNop())
+	tracker.now = func() time.Time { return now }
+	tracker.lastObserved = now
+
+	return tracker, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestSlowConsumerTrackerSendDuration(t *testing.T) {
+	policy := SlowConsumerPolicy{WarnSendDuration: 100 * time.Millisecond, DisconnectAfter: time.Second}
+
+	t.Run("alternating slow and fast sends", func(t *testing.T) {
+		tracker, advance := newTestSlowConsumerTracker(policy, func() uint64 { return 0 })
+		defer tracker.unflag()
+
+		var err error
+		for i := 0; i < 3 && err == nil; i++ {
+			advance(400 * time.Millisecond)
+			err = tracker.observe(uint64(i), true, 400*time.Millisecond, "cursor")
+			if err == nil {
+				assert.True(t, tracker.flagged)
+				advance(10 * time.Millisecond)
+				require.NoError(t, tracker.observe(uint64(i), true, time.Millisecond, "cursor"))
+				assert.True(t, tracker.flagged, "a single fast send does not clear the consumer")
+			}
+		}
+
+		var errClientTooSlow *firehose.ErrClientTooSlow
+		require.ErrorAs(t, err, &errClientTooSlow)
+		assert.Equal(t, "cursor", errClientTooSlow.LastCursor)
+	})
+
+	t.Run("recovering consumer", func(t *testing.T) {
+		tracker, advance := newTestSlowConsumerTracker(policy, func() uint64 { return 0 })
+		defer tracker.unflag()
+
+		advance(400 * time.Millisecond)
+		require.NoError(t, tracker.observe(1, true, 400*time.Millisecond, "cursor"))
+		assert.True(t, tracker.flagged)
+
+		for i := 0; i < 5; i++ {
+			advance(100 * time.Millisecond)
+			require.NoError(t, tracker.observe(2, true, time.Millisecond, "cursor"))
+		}
+		assert.False(t, tracker.flagged)
+		assert.Zero(t, tracker.slowFor)
+	})
+}
+
+func TestSlowConsumerTrackerHeadLag(t *testing.T) {
+	head := uint64(100)
+	tracker, advance := newTestSlowConsumerTracker(SlowConsumerPolicy{MaxHeadLag: 10, DisconnectAfter: time.Second}, func() uint64 { return head })
+	defer tracker.unflag()
+
+	advance(time.Second)
+	require.NoError(t, tracker.observe(50, true, 0, "cursor"), "never caught up, catching up is not slow")
+	assert.False(t, tracker.flagged)
+
+	require.NoError(t, tracker.observe(95, true, 0, "cursor"))
+	assert.True(t, tracker.caughtUp)
+
+	head = 200
+	advance(500 * time.Millisecond)
+	require.NoError(t, tracker.observe(96, true, 0, "cursor"))
+	assert.True(t, tracker.flagged)
+
+	advance(100 * time.Millisecond)
+	require.NoError(t, tracker.observe(0, false, 0, "cursor"), "responses without block do not change the lag")
+
+	advance(500 * time.Millisecond)
+	assert.Error(t, tracker.observe(97, true, 0, "cursor"))
+}
+
+// blockingBlocksServer blocks every send after the first `passing` ones until released
+type blockingBlocksServer struct {
+	testServerStream
+	passing int
+	release chan struct{}
+}
+
+func (s *blockingBlocksServer) Send(*pbfirehose.Response) error {
+	if s.passing > 0 {
+		s.passing--
+		return nil
+	}
+	<-s.release
+	return errors.New("stream closed")
+}
+
+func TestSlowConsumerStreamWatchdog(t *testing.T) {
+	client := &blockingBlocksServer{testServerStream: testServerStream{ctx: context.Background()}, passing: 1, release: make(chan struct{})}
+	summary := newSummaryStream(client, time.Now())
+
+	policy := &SlowConsumerPolicy{WarnSendDuration: 10 * time.Millisecond, DisconnectAfter: 50 * time.Millisecond}
+	slowConsumer := newSlowConsumerStream(summary, newSlowConsumerTracker(policy, func() uint64 { return 0 }, zap.NewNop()))
+	defer slowConsumer.close()
+
+	cursor := func(num uint64) string {
+		ref := bstream.NewBlockRef("id", num)
+		return (&bstream.Cursor{Step: bstream.StepNew, Block: ref, HeadBlock: ref, LIB: ref}).ToOpaque()
+	}
+
+	require.NoError(t, slowConsumer.Send(&pbfirehose.Response{Step: pbfirehose.ForkStep_STEP_NEW, Cursor: cursor(1)}))
+
+	start := time.Now()
+	err := slowConsumer.Send(&pbfirehose.Response{Step: pbfirehose.ForkStep_STEP_NEW, Cursor: cursor(2)})
+	assert.Less(t, time.Since(start), time.Second)
+
+	var errClientTooSlow *firehose.ErrClientTooSlow
+	require.ErrorAs(t, err, &errClientTooSlow)
+	assert.Equal(t, cursor(1), errClientTooSlow.LastCursor, "the last cursor is the last one the client received")
+
+	assert.Equal(t, err, slowConsumer.Send(&pbfirehose.Response{Cursor: cursor(3)}), "nothing is sent after the watchdog fired")
+
+	close(client.release)
+	blocks, _ := summary.sent()
+	assert.Equal(t, uint64(1), blocks)
+}
+
+// blockingHookStream blocks every send until released, like a slow response hook above
+// the slow consumer stream
+type blockingHookStream struct {
+	pbfirehose.Stream_BlocksServer
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingHookStream) Send(resp *pbfirehose.Response) error {
+	close(s.entered)
+	<-s.release
+	return s.Stream_BlocksServer.Send(resp)
+}
+
+func TestSlowConsumerStreamSendAfterClose(t *testing.T) {
+	client := &gatedBlocksServer{testServerStream: testServerStream{ctx: context.Background()}}
+	summary := newSummaryStream(client, time.Now())
+
+	policy := &SlowConsumerPolicy{WarnSendDuration: time.Second, DisconnectAfter: time.Second}
+	slowConsumer := newSlowConsumerStream(summary, newSlowConsumerTracker(policy, func() uint64 { return 0 }, zap.NewNop()))
+
+	hook := &blockingHookStream{Stream_BlocksServer: slowConsumer, entered: make(chan struct{}), release: make(chan struct{})}
+	buffer := newTestSendBuffer(hook, 1024, 0)
+	buffer.flushTimeout = 10 * time.Millisecond
+
+	require.NoError(t, buffer.Send(testResponse(1)))
+	<-hook.entered
+
+	// the buffer gives up while its goroutine is still in the hook, then the stream closes
+	require.Error(t, buffer.close())
+	slowConsumer.close()
+
+	close(hook.release)
+	<-buffer.done
+
+	_, received := client.state()
+	assert.Empty(t, received, "nothing is sent once the stream is closed")
+}
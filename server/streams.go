@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/streamingfast/dauth"
+	"github.com/streamingfast/firehose"
+	"github.com/streamingfast/firehose/internal/admin"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"go.uber.org/zap"
+)
+
+// StreamsAdminPathPrefix is the path under which StreamsAdminHandler serves, it must be
+// mounted as-is on the admin mux.
+const StreamsAdminPathPrefix = "/streams/"
+
+// StreamInfo describes an active `Blocks` stream. A stream is live once it sent a block
+// from the live segment of the chain covered by the hub.
+type StreamInfo struct {
+	ID uint64 `json:"id"`
+
+	UserID   string `json:"user_id,omitempty"`
+	APIKeyID string `json:"api_key_id,omitempty"`
+	IP       string `json:"ip,omitempty"`
+
+	StartBlock      int64     `json:"start_block"`
+	StopBlock       uint64    `json:"stop_block,omitempty"`
+	Cursor          string    `json:"cursor,omitempty"`
+	Transforms      string    `json:"transforms,omitempty"`
+	FinalBlocksOnly bool      `json:"final_blocks_only,omitempty"`
+	StartedAt       time.Time `json:"started_at"`
+
+	CurrentBlock uint64 `json:"current_block"`
+	BlocksSent   uint64 `json:"blocks_sent"`
+	BytesSent    uint64 `json:"bytes_sent"`
+	Live         bool   `json:"live"`
+}
+
+func (s *Server) newStreamInfo(ctx context.Context, request *pbfirehose.Request, start time.Time) StreamInfo {
+	auth := dauth.FromContext(ctx)
+	return StreamInfo{
+		UserID:          auth.UserID(),
+		APIKeyID:        auth.APIKeyID(),
+		IP:              auth.RealIP(),
+		StartBlock:      request.StartBlockNum,
+		StopBlock:       request.StopBlockNum,
+		Cursor:          request.Cursor,
+		Transforms:      transformsDescription(s.transformRegistry, request.Transforms),
+		FinalBlocksOnly: request.FinalBlocksOnly,
+		StartedAt:       start,
+	}
+}
+
+// observeBlock records the block the stream is at, it is a no-op on untracked streams
+func (s *activeStream) observeBlock(num uint64, live bool) {
+	if s == nil {
+		return
+	}
+	s.currentBlock.Store(num)
+	s.live.Store(live)
+}
+
+// observeSent records a response that reached the client, it is a no-op on untracked
+// streams.
+func (s *activeStream) observeSent(step pbfirehose.ForkStep, size uint64) {
+	if s == nil {
+		return
+	}
+	if step != pbfirehose.ForkStep_STEP_UNSET {
+		s.blocksSent.Inc()
+	}
+	s.bytesSent.Add(size)
+}
+
+// canceledError returns the error the stream must terminate with when an operator
+// canceled it, nil otherwise.
+func (s *activeStream) canceledError() error {
+	if s == nil {
+		return nil
+	}
+	return s.canceled.Load()
+}
+
+func (s *activeStream) snapshot() StreamInfo {
+	out := s.info
+	out.CurrentBlock = s.currentBlock.Load()
+	out.BlocksSent = s.blocksSent.Load()
+	out.BytesSent = s.bytesSent.Load()
+	out.Live = s.live.Load()
+	return out
+}
+
+// Streams returns the active `Blocks` streams, sorted by ID
+func (s *Server) Streams() []StreamInfo {
+	s.streams.mu.Lock()
+	defer s.streams.mu.Unlock()
+
+	out := make([]StreamInfo, 0, len(s.streams.streams))
+	for _, stream := range s.streams.streams {
+		out = append(out, stream.snapshot())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// CancelStream terminates an active stream, the client receiving an `Aborted` error
+// with reason `STREAM_CANCELED` and the given explanation. It returns false if no such
+// stream is active.
+func (s *Server) CancelStream(id uint64, reason string) bool {
+	s.streams.mu.Lock()
+	defer s.streams.mu.Unlock()
+
+	stream, found := s.streams.streams[id]
+	if !found {
+		return false
+	}
+	stream.canceled.Store(firehose.NewErrStreamCanceled(reason))
+	stream.cancel()
+	return true
+}
+
+// CancelUserStreams terminates all the active streams of a user like CancelStream does,
+// it returns how many were canceled.
+func (s *Server) CancelUserStreams(userID string, reason string) int {
+	s.streams.mu.Lock()
+	defer s.streams.mu.Unlock()
+
+	var canceled int
+	for _, stream := range s.streams.streams {
+		if stream.info.UserID != userID {
+			continue
+		}
+		stream.canceled.Store(firehose.NewErrStreamCanceled(reason))
+		stream.cancel()
+		canceled++
+	}
+	return canceled
+}
+
+// StreamsAdminHandler serves the active streams to operators:
+//
+//	GET    /streams/                   active streams, of a user with `?user_id=`
+//	GET    /streams/<id>               an active stream
+//	DELETE /streams/<id>               cancel a stream
+//	DELETE /streams/?user_id=<user id> cancel all the streams of a user
+//
+// Cancellations take the explanation sent to the client in the `reason` query parameter.
+// It must only be exposed on an administration listener, it is not authenticated.
+func (s *Server) StreamsAdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawID := strings.TrimPrefix(r.URL.Path, StreamsAdminPathPrefix)
+		userID := r.URL.Query().Get("user_id")
+		reason := r.URL.Query().Get("reason")
+		if reason == "" {
+			reason = "no reason given"
+		}
+
+		var id uint64
+		if rawID != "" {
+			var err error
+			if id, err = strconv.ParseUint(rawID, 10, 64); err != nil {
+				http.Error(w, "invalid stream id", http.StatusBadRequest)
+				return
+			}
+		}
+
+		switch {
+		case r.Method == http.MethodGet && rawID == "":
+			out := []StreamInfo{}
+			for _, stream := range s.Streams() {
+				if userID == "" || stream.UserID == userID {
+					out = append(out, stream)
+				}
+			}
+			admin.WriteJSON(w, http.StatusOK, out, s.logger)
+
+		case r.Method == http.MethodGet:
+			for _, stream := range s.Streams() {
+				if stream.ID == id {
+					admin.WriteJSON(w, http.StatusOK, stream, s.logger)
+					return
+				}
+			}
+			http.Error(w, "no such active stream", http.StatusNotFound)
+
+		case r.Method == http.MethodDelete && rawID != "":
+			if !s.CancelStream(id, reason) {
+				http.Error(w, "no such active stream", http.StatusNotFound)
+				return
+			}
+			s.logger.Info("stream canceled by operator", zap.Uint64("stream_id", id), zap.String("reason", reason))
+			w.WriteHeader(http.StatusNoContent)
+
+		case r.Method == http.MethodDelete && userID != "":
+			canceled := s.CancelUserStreams(userID, reason)
+			s.logger.Info("user streams canceled by operator", zap.String("user_id", userID), zap.Int("canceled", canceled), zap.String("reason", reason))
+			admin.WriteJSON(w, http.StatusOK, map[string]int{"canceled": canceled}, s.logger)
+
+		case r.Method == http.MethodDelete:
+			http.Error(w, "a stream id or a user_id is required", http.StatusBadRequest)
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
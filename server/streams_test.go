@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/dauth"
+	"github.com/streamingfast/firehose"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestStreamsAdminHandler(t *testing.T) {
+	s := &Server{logger: zap.NewNop(), streams: newActiveStreams()}
+	handler := s.StreamsAdminHandler()
+
+	aliceCtx, aliceDone := s.streams.track(context.Background(), StreamInfo{UserID: "alice", StartBlock: 10})
+	defer aliceDone()
+	otherAliceCtx, otherAliceDone := s.streams.track(context.Background(), StreamInfo{UserID: "alice"})
+	defer otherAliceDone()
+	bobCtx, bobDone := s.streams.track(context.Background(), StreamInfo{UserID: "bob"})
+	defer bobDone()
+
+	activeStreamFromContext(aliceCtx).observeBlock(12, true)
+	activeStreamFromContext(aliceCtx).observeSent(pbfirehose.ForkStep_STEP_NEW, 128)
+
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/streams/")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var streams []StreamInfo
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &streams))
+	require.Len(t, streams, 3)
+	assert.Equal(t, uint64(1), streams[0].ID)
+	assert.Equal(t, int64(10), streams[0].StartBlock)
+	assert.Equal(t, uint64(12), streams[0].CurrentBlock)
+	assert.Equal(t, uint64(1), streams[0].BlocksSent)
+	assert.Equal(t, uint64(128), streams[0].BytesSent)
+	assert.True(t, streams[0].Live)
+	assert.False(t, streams[1].Live)
+
+	rec = serve(http.MethodGet, "/streams/?user_id=bob")
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &streams))
+	require.Len(t, streams, 1)
+	assert.Equal(t, uint64(3), streams[0].ID)
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/streams/3").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/streams/42").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodGet, "/streams/abc").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodDelete, "/streams/").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPost, "/streams/").Code)
+
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "/streams/3?reason=maintenance").Code)
+	assert.Error(t, bobCtx.Err())
+	assert.Equal(t, firehose.NewErrStreamCanceled("maintenance"), activeStreamFromContext(bobCtx).canceledError())
+	assert.NoError(t, aliceCtx.Err())
+
+	rec = serve(http.MethodDelete, "/streams/?user_id=alice&reason=abuse")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"canceled":2}`, rec.Body.String())
+	assert.Error(t, aliceCtx.Err())
+	assert.Error(t, otherAliceCtx.Err())
+}
+
+func TestCancelRunningStream(t *testing.T) {
+	s, _ := newMeteringTestServer(t)
+
+	ctx := dauth.WithTrustedHeaders(context.Background(), dauth.TrustedHeaders{dauth.SFHeaderUserID: "alice"})
+
+	result := make(chan error)
+	go func() {
+		// without stop block, the stream waits for the next merged blocks file once it sent the first one
+		result <- s.Blocks(&pbfirehose.Request{StartBlockNum: 2, FinalBlocksOnly: true}, testBlocksServer{&testServerStream{ctx: ctx}})
+	}()
+
+	require.Eventually(t, func() bool {
+		streams := s.Streams()
+		return len(streams) == 1 && streams[0].BlocksSent == 4
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stream := s.Streams()[0]
+	assert.Equal(t, "alice", stream.UserID)
+	assert.Equal(t, uint64(5), stream.CurrentBlock)
+	assert.False(t, stream.Live)
+
+	assert.Equal(t, 1, s.CancelUserStreams("alice", "maintenance"))
+
+	select {
+	case err := <-result:
+		assert.Equal(t, firehose.NewErrStreamCanceled("maintenance"), err)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "stream was not canceled")
+	}
+	assert.Empty(t, s.Streams())
+}
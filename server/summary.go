@@ -0,0 +1,151 @@
+package server
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/firehose"
+	"github.com/streamingfast/firehose/metrics"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Response trailer metadata keys summarizing a `Blocks` stream, always sent when the
+// stream terminates. The last cursor and last block are only sent when at least one
+// response carrying a cursor reached the client.
+const (
+	LastCursorTrailer        = "x-firehose-last-cursor"
+	BlocksSentTrailer        = "x-firehose-blocks-sent"
+	BytesSentTrailer         = "x-firehose-bytes-sent"
+	LastBlockTrailer         = "x-firehose-last-block"
+	TerminationReasonTrailer = "x-firehose-termination-reason"
+	HeadBlockTrailer         = "x-firehose-head-block"
+	LIBTrailer               = "x-firehose-lib-block"
+)
+
+// TerminationCompleted is the termination reason of a stream that reached its stop block.
+const TerminationCompleted = "COMPLETED"
+
+// summaryStream counts what is actually sent to the client, it must wrap the client
+// stream directly. A send abandoned by the slow consumer watchdog can still complete
+// after the stream terminated, the counters are guarded accordingly.
+type summaryStream struct {
+	pbfirehose.Stream_BlocksServer
+
+	start  time.Time
+	stream *activeStream
+
+	mu         sync.Mutex
+	blocks     uint64
+	bytes      uint64
+	lastCursor string
+}
+
+func newSummaryStream(streamSrv pbfirehose.Stream_BlocksServer, start time.Time) *summaryStream {
+	return &summaryStream{
+		Stream_BlocksServer: streamSrv,
+		start:               start,
+	}
+}
+
+func (s *summaryStream) Send(resp *pbfirehose.Response) error {
+	sendStart := time.Now()
+	if err := s.Stream_BlocksServer.Send(resp); err != nil {
+		return err
+	}
+	metrics.StreamSendLatency.ObserveSince(sendStart)
+
+	size := uint64(proto.Size(resp))
+	s.stream.observeSent(resp.Step, size)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bytes += size
+	if resp.Step != pbfirehose.ForkStep_STEP_UNSET {
+		if s.blocks == 0 {
+			metrics.StreamTimeToFirstBlock.ObserveSince(s.start)
+		}
+		s.blocks++
+	}
+	if resp.Cursor != "" {
+		s.lastCursor = resp.Cursor
+	}
+	return nil
+}
+
+// sent returns the number of blocks and bytes that reached the client
+func (s *summaryStream) sent() (blocks uint64, bytes uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.blocks, s.bytes
+}
+
+// lastSentCursor returns the cursor of the last response that reached the client
+func (s *summaryStream) lastSentCursor() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastCursor
+}
+
+// setTrailer sends the summary, `err` being the error returned to the client
+func (s *summaryStream) setTrailer(err error, headNum, libNum uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	md := metadata.Pairs(
+		BlocksSentTrailer, strconv.FormatUint(s.blocks, 10),
+		BytesSentTrailer, strconv.FormatUint(s.bytes, 10),
+		TerminationReasonTrailer, terminationReason(err),
+		HeadBlockTrailer, strconv.FormatUint(headNum, 10),
+		LIBTrailer, strconv.FormatUint(libNum, 10),
+	)
+
+	if s.lastCursor != "" {
+		md.Set(LastCursorTrailer, s.lastCursor)
+		if blockNum, ok := cursorBlockNum(s.lastCursor); ok {
+			md.Set(LastBlockTrailer, strconv.FormatUint(blockNum, 10))
+		}
+	}
+
+	s.SetTrailer(md)
+}
+
+// observe records the lifecycle of the stream once it terminated
+func (s *summaryStream) observe() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	metrics.StreamDuration.ObserveSince(s.start)
+	metrics.StreamBlocks.ObserveFloat64(float64(s.blocks))
+	metrics.StreamBytes.ObserveFloat64(float64(s.bytes))
+}
+
+// terminationReason is the `ErrorInfo` reason of `err` when it has one, its gRPC code
+// otherwise.
+func terminationReason(err error) string {
+	if err == nil {
+		return TerminationCompleted
+	}
+
+	st := status.Convert(err)
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Reason != "" {
+			return info.Reason
+		}
+	}
+	return st.Code().String()
+}
+
+// cursorBlockNum decodes the block number of a regular or multi-range cursor, segment
+// boundary cursors having none.
+func cursorBlockNum(opaqueCursor string) (uint64, bool) {
+	cursor, err := firehose.DecodeCursor(opaqueCursor)
+	if err != nil || cursor.SegmentBoundary {
+		return 0, false
+	}
+	return cursor.Block.Num(), true
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/firehose"
+	"github.com/streamingfast/firehose/metrics"
+	pbfirehose "github.com/streamingfast/pbgo/sf/firehose/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTerminationReason(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"completed", nil, TerminationCompleted},
+		{"with reason", firehose.NewErrClientTooSlow("", "too slow").GRPCStatus().Err(), firehose.ReasonClientTooSlow},
+		{"plain status", status.Error(codes.Canceled, "source canceled"), "Canceled"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, terminationReason(test.err))
+		})
+	}
+}
+
+func TestCursorBlockNum(t *testing.T) {
+	cursor := (&bstream.Cursor{
+		Step:      bstream.StepNew,
+		Block:     bstream.NewBlockRef("12b", 12),
+		HeadBlock: bstream.NewBlockRef("12b", 12),
+		LIB:       bstream.NewBlockRef("10a", 10),
+	}).ToOpaque()
+
+	tests := []struct {
+		name          string
+		cursor        string
+		expectedNum   uint64
+		expectedFound bool
+	}{
+		{"regular", cursor, 12, true},
+		{"segment", firehose.EncodeSegmentCursor(1, cursor), 12, true},
+		{"segment boundary", firehose.EncodeSegmentCursor(2, ""), 0, false},
+		{"invalid", "not a cursor", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			num, found := cursorBlockNum(test.cursor)
+			assert.Equal(t, test.expectedFound, found)
+			assert.Equal(t, test.expectedNum, num)
+		})
+	}
+}
+
+func sampleCount(t *testing.T, metric prometheus.Metric) uint64 {
+	t.Helper()
+
+	out := &dto.Metric{}
+	require.NoError(t, metric.Write(out))
+	if out.Histogram != nil {
+		return out.Histogram.GetSampleCount()
+	}
+	return uint64(out.Counter.GetValue())
+}
+
+func TestStreamLifecycleMetrics(t *testing.T) {
+	s, _ := newMeteringTestServer(t)
+
+	durations := sampleCount(t, metrics.StreamDuration.Native())
+	blocks := sampleCount(t, metrics.StreamBlocks.Native())
+	firstBlocks := sampleCount(t, metrics.StreamTimeToFirstBlock.Native())
+	sends := sampleCount(t, metrics.StreamSendLatency.Native())
+	completed := sampleCount(t, metrics.StreamTerminations.Native().WithLabelValues(codes.OK.String()))
+	invalid := sampleCount(t, metrics.StreamTerminations.Native().WithLabelValues(codes.InvalidArgument.String()))
+
+	ctx := context.Background()
+	require.NoError(t, s.Blocks(&pbfirehose.Request{StartBlockNum: 2, StopBlockNum: 4}, testBlocksServer{&testServerStream{ctx: ctx}}))
+	require.Error(t, s.Blocks(&pbfirehose.Request{StartBlockNum: 2, StopBlockNum: 4, Cursor: "invalid"}, testBlocksServer{&testServerStream{ctx: ctx}}))
+
+	assert.Equal(t, durations+2, sampleCount(t, metrics.StreamDuration.Native()))
+	assert.Equal(t, blocks+2, sampleCount(t, metrics.StreamBlocks.Native()))
+	assert.Equal(t, firstBlocks+1, sampleCount(t, metrics.StreamTimeToFirstBlock.Native()), "only the stream that sent blocks")
+	assert.Equal(t, sends+3, sampleCount(t, metrics.StreamSendLatency.Native()))
+	assert.Equal(t, completed+1, sampleCount(t, metrics.StreamTerminations.Native().WithLabelValues(codes.OK.String())))
+	assert.Equal(t, invalid+1, sampleCount(t, metrics.StreamTerminations.Native().WithLabelValues(codes.InvalidArgument.String())))
+}
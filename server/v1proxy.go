@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 
 	pbfirehoseV1 "github.com/streamingfast/pbgo/sf/firehose/v1"
@@ -54,17 +55,23 @@ func (s *FirehoseProxyV1ToV2) Blocks(req *pbfirehoseV1.Request, streamSrv pbfire
 		Transforms:      req.Transforms,
 	}
 
-	wrapper := streamWrapper{ServerStream: streamSrv, next: streamSrv, withUndo: withUndo}
+	ctx := withMeteringEndpoint(streamSrv.Context(), MeteringEndpointBlocksV1)
+	wrapper := streamWrapper{ServerStream: streamSrv, ctx: ctx, next: streamSrv, withUndo: withUndo}
 
 	return s.server.Blocks(reqV2, wrapper)
 }
 
 type streamWrapper struct {
 	grpc.ServerStream
+	ctx      context.Context
 	next     pbfirehoseV1.Stream_BlocksServer
 	withUndo bool
 }
 
+func (w streamWrapper) Context() context.Context {
+	return w.ctx
+}
+
 func (w streamWrapper) Send(response *pbfirehoseV2.Response) error {
 	return w.next.Send(&pbfirehoseV1.Response{
 		Block:  response.Block,
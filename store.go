@@ -0,0 +1,123 @@
+package firehose
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/streamingfast/dstore"
+)
+
+// requestStore returns the store to read `source` from for one request: a clone of
+// `store` metered against the request when the store can be cloned, reporting its
+// failures as ErrStoreUnavailable. A nil store is returned as is.
+func requestStore(ctx context.Context, store dstore.Store, source BlockSource) (dstore.Store, error) {
+	if store == nil {
+		return nil, nil
+	}
+
+	name := storeName(source)
+	if clonable, ok := store.(dstore.Clonable); ok {
+		clone, err := clonable.Clone(ctx)
+		if err != nil {
+			return nil, NewErrStoreUnavailable(name, err)
+		}
+		clone.SetMeter(newStoreMeter(ctx, source))
+		store = clone
+	}
+
+	return &unavailableStore{Store: store, name: name}, nil
+}
+
+func storeName(source BlockSource) string {
+	switch source {
+	case BlockSourceMergedBlocks:
+		return "merged blocks"
+	case BlockSourceForkedBlocks:
+		return "forked blocks"
+	}
+	return string(source)
+}
+
+// unavailableStore reports the failures of the store it wraps as ErrStoreUnavailable,
+// including the ones surfacing from inside a bstream file source reading it. Missing
+// files, stopped iterations and canceled contexts are returned unchanged.
+type unavailableStore struct {
+	dstore.Store
+	name string
+}
+
+func (s *unavailableStore) wrap(err error) error {
+	var errStoreUnavailable *ErrStoreUnavailable
+	if err == nil ||
+		errors.Is(err, dstore.ErrNotFound) ||
+		errors.Is(err, dstore.StopIteration) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &errStoreUnavailable) {
+		return err
+	}
+	return NewErrStoreUnavailable(s.name, err)
+}
+
+func (s *unavailableStore) OpenObject(ctx context.Context, name string) (io.ReadCloser, error) {
+	reader, err := s.Store.OpenObject(ctx, name)
+	if err != nil {
+		return nil, s.wrap(err)
+	}
+	return &unavailableReader{ReadCloser: reader, store: s}, nil
+}
+
+func (s *unavailableStore) FileExists(ctx context.Context, base string) (bool, error) {
+	exists, err := s.Store.FileExists(ctx, base)
+	return exists, s.wrap(err)
+}
+
+func (s *unavailableStore) ObjectAttributes(ctx context.Context, base string) (*dstore.ObjectAttributes, error) {
+	attrs, err := s.Store.ObjectAttributes(ctx, base)
+	return attrs, s.wrap(err)
+}
+
+func (s *unavailableStore) ListFiles(ctx context.Context, prefix string, max int) ([]string, error) {
+	files, err := s.Store.ListFiles(ctx, prefix, max)
+	return files, s.wrap(err)
+}
+
+func (s *unavailableStore) Walk(ctx context.Context, prefix string, f func(filename string) error) error {
+	var callbackErr error
+	err := s.Store.Walk(ctx, prefix, func(filename string) error {
+		callbackErr = f(filename)
+		return callbackErr
+	})
+	return s.walkErr(err, callbackErr)
+}
+
+func (s *unavailableStore) WalkFrom(ctx context.Context, prefix, startingPoint string, f func(filename string) error) error {
+	var callbackErr error
+	err := s.Store.WalkFrom(ctx, prefix, startingPoint, func(filename string) error {
+		callbackErr = f(filename)
+		return callbackErr
+	})
+	return s.walkErr(err, callbackErr)
+}
+
+// walkErr returns the errors of a walk callback unchanged, they are not store failures.
+func (s *unavailableStore) walkErr(err, callbackErr error) error {
+	if err != nil && callbackErr != nil && errors.Is(err, callbackErr) {
+		return err
+	}
+	return s.wrap(err)
+}
+
+type unavailableReader struct {
+	io.ReadCloser
+	store *unavailableStore
+}
+
+func (r *unavailableReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		return n, err
+	}
+	return n, r.store.wrap(err)
+}
@@ -0,0 +1,65 @@
+package firehose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestStoreReportsFailuresAsUnavailable(t *testing.T) {
+	failure := fmt.Errorf("connection reset by peer")
+	callbackErr := fmt.Errorf("callback failed")
+
+	mock := dstore.NewMockStore(nil)
+	mock.FileExistsFunc = func(_ context.Context, base string) (bool, error) {
+		if base == "missing" {
+			return false, dstore.ErrNotFound
+		}
+		return false, failure
+	}
+	mock.OpenObjectFunc = func(_ context.Context, name string) (io.ReadCloser, error) {
+		return io.NopCloser(io.MultiReader(strings.NewReader("data"), iotest.ErrReader(failure))), nil
+	}
+	mock.WalkFunc = func(_ context.Context, _ string, f func(filename string) error) error {
+		if err := f("0000000000"); err != nil {
+			return err
+		}
+		return failure
+	}
+
+	store, err := requestStore(context.Background(), mock, BlockSourceMergedBlocks)
+	require.NoError(t, err)
+
+	var errStoreUnavailable *ErrStoreUnavailable
+
+	_, err = store.FileExists(context.Background(), "0000000000")
+	require.True(t, errors.As(err, &errStoreUnavailable))
+	assert.Equal(t, "merged blocks", errStoreUnavailable.Store)
+	assert.ErrorIs(t, err, failure)
+
+	_, err = store.FileExists(context.Background(), "missing")
+	assert.Equal(t, dstore.ErrNotFound, err)
+
+	reader, err := store.OpenObject(context.Background(), "0000000000")
+	require.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	assert.True(t, errors.As(err, &errStoreUnavailable))
+
+	err = store.Walk(context.Background(), "", func(string) error { return nil })
+	assert.True(t, errors.As(err, &errStoreUnavailable))
+
+	err = store.Walk(context.Background(), "", func(string) error { return callbackErr })
+	assert.Equal(t, callbackErr, err)
+
+	nilStore, err := requestStore(context.Background(), nil, BlockSourceForkedBlocks)
+	require.NoError(t, err)
+	assert.Nil(t, nilStore)
+}